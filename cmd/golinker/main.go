@@ -0,0 +1,75 @@
+// Command golinker produces and maintains the packages that distribute code as
+// object files for github.com/romance-dev/golinker.
+//
+// Usage:
+//
+//	golinker pack [flags] <package dir>
+//	golinker stub [flags] <package dir>
+//	golinker mod solve [flags] <stub package>...
+//	golinker mod sync [flags] [packages]
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	l "log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var log = l.New(os.Stderr, "golinker: ", 0)
+
+// errUsage is returned by a command after printing its usage. golinker exits with status 2.
+var errUsage = errors.New("invalid usage")
+
+const usage = `Usage:
+
+	golinker pack [flags] <package dir>   compile a package into object bundles
+	golinker stub [flags] <package dir>   generate the stub package that loads them
+	golinker mod <command> [arguments]    maintain go.mod for the pins of stub packages
+
+Run "golinker <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "pack":
+		err = pack(args)
+	case "stub":
+		err = stub(args)
+	case "mod":
+		err = mod(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "golinker: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	} else if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// run runs a command in dir with extra environment variables and returns its trimmed stdout.
+func run(dir string, env []string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/romance-dev/golinker/internal/depspec"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const golinkerImportPath = "github.com/romance-dev/golinker"
+
+// pinnedComment precedes the replace block that golinker mod adds to go.mod.
+const pinnedComment = "// Pinned by golinker stubs"
+
+const modUsage = `Usage:
+
+	golinker mod solve [flags] <stub package>...   compute the go.mod pins every stub requires
+	golinker mod sync [flags] [packages]           update go.mod for the stubs among the dependencies
+
+Run "golinker mod <command> -h" for the flags of a command.
+`
+
+const modSolveUsage = `Usage: golinker mod solve [flags] <stub package>...
+
+Reads the dependencies pinned by the golinker.CheckDeps calls of the stub packages
+(directories or import paths) and computes require and replace directives that satisfy
+every pin. The directives are printed, or written into go.mod with -w. If pins can not
+be satisfied together, each conflicting dependency is listed with the pins and where
+they are declared.
+
+Flags:
+`
+
+const modSyncUsage = `Usage: golinker mod sync [flags] [packages]
+
+Finds the golinker stub packages among the dependencies of the packages (default: ./...)
+and updates the require and replace directives of go.mod in place so that every pin of
+their golinker.CheckDeps calls is satisfied. Existing lines and comments are kept.
+Replacements that golinker added which no stub pins anymore are removed. With -n the
+changes are printed as a diff and go.mod is left untouched.
+
+Flags:
+`
+
+func mod(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, modUsage)
+		return errUsage
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "solve":
+		return modSolve(args)
+	case "sync":
+		return modSync(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, modUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "golinker mod: unknown command %q\n\n%s", cmd, modUsage)
+		return errUsage
+	}
+	return nil
+}
+
+// pin is a dependency declared by a CheckDeps call. See golinker.ParseDep for the format.
+type pin struct {
+	Module string // module declaring the pin
+	Pos    string // file:line of the declaration
+	depspec.Spec
+}
+
+func (p pin) String() string {
+	s := p.Required
+	if p.Replace != "" && p.Replace != p.Path {
+		s = p.Replace + " " + s
+	}
+	if p.Sum != "" {
+		s += " " + p.Sum
+	}
+	return s
+}
+
+// listedPackage is the subset of go list -json used to find pins.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	Imports    []string
+	Error      *struct{ Err string }
+}
+
+// stubPackages lists the packages matching patterns that import golinker, as built with the
+// shrinkpkg<goversion> tag. With deps, the dependencies of the packages are searched instead.
+// Packages without files for goversion are skipped.
+func stubPackages(dir string, goversion string, deps bool, patterns ...string) ([]listedPackage, error) {
+	args := []string{"list", "-e", "-tags", "shrinkpkg" + goversion, "-json=ImportPath,Dir,GoFiles,Imports,Error"}
+	if deps {
+		args = append(args, "-deps")
+	}
+	out, err := run(dir, nil, "go", append(args, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := []listedPackage{}
+	d := json.NewDecoder(strings.NewReader(out))
+	for {
+		var pkg listedPackage
+		if err := d.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if pkg.Error != nil {
+			if len(pkg.GoFiles) == 0 && pkg.Dir != "" {
+				log.Printf("%s: skipped: %s", pkg.ImportPath, pkg.Error.Err)
+				continue
+			}
+			return nil, errors.New(pkg.Error.Err)
+		}
+		for _, imp := range pkg.Imports {
+			if imp == golinkerImportPath {
+				pkgs = append(pkgs, pkg)
+				break
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// readPins returns the pins declared by the golinker.CheckDeps calls of a package.
+// The arguments must be string literals, as written by golinker stub.
+func readPins(pkg listedPackage) ([]pin, error) {
+	fset := token.NewFileSet()
+	pins := []pin{}
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		golinkerName := ""
+		for _, imp := range f.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == golinkerImportPath {
+				golinkerName = "golinker"
+				if imp.Name != nil {
+					golinkerName = imp.Name.Name
+				}
+			}
+		}
+		if golinkerName == "" {
+			continue
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || err != nil {
+				return err == nil
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "CheckDeps" {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != golinkerName {
+				return true
+			}
+			args := []string{}
+			for _, arg := range call.Args {
+				lit, ok := arg.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					err = fmt.Errorf("%s: CheckDeps argument is not a string literal", fset.Position(arg.Pos()))
+					return false
+				}
+				s, _ := strconv.Unquote(lit.Value)
+				args = append(args, s)
+			}
+			if len(args) == 0 {
+				err = fmt.Errorf("%s: CheckDeps without a module name", fset.Position(call.Pos()))
+				return false
+			}
+			for i, s := range args[1:] {
+				spec, perr := depspec.Parse(s)
+				if perr != nil {
+					err = fmt.Errorf("%s: %w", fset.Position(call.Args[i+1].Pos()), perr)
+					return false
+				}
+				pins = append(pins, pin{Module: args[0], Pos: fset.Position(call.Args[i+1].Pos()).String(), Spec: spec})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pins, nil
+}
+
+// resolvedPin is the require and replace directive satisfying every pin of a dependency.
+type resolvedPin struct {
+	Path     string
+	Version  string // highest version required
+	Replace  string
+	Required string
+}
+
+// pinConflict is a dependency whose pins can not be satisfied together.
+type pinConflict struct {
+	Path string
+	Pins []pin
+}
+
+// solve computes the directives satisfying pins, sorted by path. mainModule can not be pinned.
+func solve(mainModule string, pins []pin) ([]resolvedPin, []pinConflict) {
+	byPath := map[string][]pin{}
+	paths := []string{}
+	for _, p := range pins {
+		if _, ok := byPath[p.Path]; !ok {
+			paths = append(paths, p.Path)
+		}
+		byPath[p.Path] = append(byPath[p.Path], p)
+	}
+	sort.Strings(paths)
+
+	resolved := []resolvedPin{}
+	conflicts := []pinConflict{}
+	for _, path := range paths {
+		ps := byPath[path]
+		ok := path != mainModule
+		for i := range ps {
+			for j := i + 1; j < len(ps) && ok; j++ {
+				ok = depspec.SameSource(ps[i].Spec, ps[j].Spec)
+			}
+		}
+		if !ok {
+			conflicts = append(conflicts, pinConflict{Path: path, Pins: ps})
+			continue
+		}
+		r := resolvedPin{Path: path, Version: ps[0].Version, Replace: ps[0].Built(), Required: ps[0].Required}
+		for _, p := range ps[1:] {
+			if semver.Compare(p.Version, r.Version) > 0 {
+				r.Version = p.Version
+			}
+		}
+		resolved = append(resolved, r)
+	}
+	return resolved, conflicts
+}
+
+// applyPins adds the require and replace directives to f. Existing lines are updated
+// in place, keeping their comments, and new replacements are added to the pinned block.
+func applyPins(f *modfile.File, resolved []resolvedPin) error {
+	var block *modfile.LineBlock
+	for _, r := range resolved {
+		version := r.Version
+		for _, req := range f.Require {
+			if req.Mod.Path == r.Path && semver.Compare(req.Mod.Version, version) > 0 {
+				version = req.Mod.Version // the replacement decides what is built
+			}
+		}
+		if err := f.AddRequire(r.Path, version); err != nil {
+			return err
+		}
+
+		replaced := false
+		for _, rep := range f.Replace {
+			replaced = replaced || rep.Old.Path == r.Path
+		}
+		if replaced {
+			// Updates the first replacement of any version and removes the others
+			if err := f.AddReplace(r.Path, "", r.Replace, r.Required); err != nil {
+				return err
+			}
+			continue
+		}
+		if block == nil {
+			block = pinnedBlock(f)
+		}
+		line := &modfile.Line{Token: []string{modfile.AutoQuote(r.Path), "=>", modfile.AutoQuote(r.Replace), r.Required}, InBlock: true}
+		block.Line = append(block.Line, line)
+		f.Replace = append(f.Replace, &modfile.Replace{
+			Old:    module.Version{Path: r.Path},
+			New:    module.Version{Path: r.Replace, Version: r.Required},
+			Syntax: line,
+		})
+	}
+	f.Cleanup()
+	return nil
+}
+
+// pinnedBlock returns the replace block written by applyPins, creating it at the end of f
+// if required. A block holding a single pin is formatted as one line, which is turned
+// back into a block.
+func pinnedBlock(f *modfile.File) *modfile.LineBlock {
+	for i, stmt := range f.Syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *modfile.LineBlock:
+			if isPinned(stmt.Comments, stmt.Token) {
+				return stmt
+			}
+		case *modfile.Line:
+			if isPinned(stmt.Comments, stmt.Token) {
+				block := &modfile.LineBlock{Token: []string{"replace"}, Line: []*modfile.Line{stmt}}
+				block.Before, stmt.Before = stmt.Before, nil
+				stmt.Token = stmt.Token[1:]
+				stmt.InBlock = true
+				f.Syntax.Stmt[i] = block
+				return block
+			}
+		}
+	}
+	block := &modfile.LineBlock{Token: []string{"replace"}}
+	block.Before = []modfile.Comment{{Token: pinnedComment}}
+	f.Syntax.Stmt = append(f.Syntax.Stmt, block)
+	return block
+}
+
+// isPinned reports whether a replace line or block follows the pinnedComment.
+func isPinned(comments modfile.Comments, token []string) bool {
+	if len(token) == 0 || token[0] != "replace" {
+		return false
+	}
+	for _, c := range comments.Before {
+		if c.Token == pinnedComment {
+			return true
+		}
+	}
+	return false
+}
+
+// prunePins removes the replacements written by applyPins that are not resolved.
+func prunePins(f *modfile.File, resolved []resolvedPin) {
+	keep := map[string]bool{}
+	for _, r := range resolved {
+		keep[r.Path] = true
+	}
+	pinned := map[*modfile.Line]bool{}
+	for _, stmt := range f.Syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *modfile.LineBlock:
+			if isPinned(stmt.Comments, stmt.Token) {
+				for _, line := range stmt.Line {
+					pinned[line] = true
+				}
+			}
+		case *modfile.Line:
+			if isPinned(stmt.Comments, stmt.Token) {
+				pinned[stmt] = true
+			}
+		}
+	}
+	for _, rep := range f.Replace {
+		if pinned[rep.Syntax] && !keep[rep.Old.Path] {
+			f.DropReplace(rep.Old.Path, rep.Old.Version)
+		}
+	}
+	f.Cleanup()
+}
+
+// fprintConflicts explains which pins can not be satisfied together.
+func fprintConflicts(w io.Writer, conflicts []pinConflict, mainModule string) {
+	fmt.Fprintln(w, "pins that can not be satisfied together:")
+	for _, c := range conflicts {
+		fmt.Fprintf(w, "\n%s\n", c.Path)
+		if c.Path == mainModule {
+			fmt.Fprintln(w, "\tis the main module and can not be replaced")
+		}
+		for _, p := range c.Pins {
+			fmt.Fprintf(w, "\t%s requires %s\n\t\t%s\n", p.Module, p, p.Pos)
+		}
+	}
+}
+
+// goModPath returns the go.mod of the module in dir.
+func goModPath(dir string) (string, error) {
+	gomod, err := run(dir, nil, "go", "env", "GOMOD")
+	if err != nil {
+		return "", err
+	}
+	if gomod == "" || gomod == os.DevNull {
+		return "", errors.New("go.mod not found")
+	}
+	return gomod, nil
+}
+
+func modSolve(args []string) error {
+	fs := flag.NewFlagSet("mod solve", flag.ExitOnError)
+	goversion := fs.String("go", "", "Go version whose stub files are read (default: the local toolchain's)")
+	gomod := fs.String("modfile", "", "go.mod to update (default: the current module's)")
+	write := fs.Bool("w", false, "write the directives into go.mod instead of printing them")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), modSolveUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	_, f, err := readModFile(goversion, gomod)
+	if err != nil {
+		return err
+	}
+	pkgs, err := stubPackages("", *goversion, false, fs.Args()...)
+	if err != nil {
+		return err
+	}
+	pins, err := collectPins(pkgs, true)
+	if err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		return errors.New("no CheckDeps pins found")
+	}
+
+	resolved, err := solvePins(f, pins)
+	if err != nil {
+		return err
+	}
+	if !*write {
+		out := &modfile.File{Syntax: &modfile.FileSyntax{}}
+		if err := applyPins(out, resolved); err != nil {
+			return err
+		}
+		fmt.Print(string(bytes.TrimLeft(modfile.Format(out.Syntax), "\n")))
+		return nil
+	}
+	if err := applyPins(f, resolved); err != nil {
+		return err
+	}
+	out, err := f.Format()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*gomod, out, 0644); err != nil {
+		return err
+	}
+	log.Printf("wrote %s (%d pins). Run go mod tidy to update go.sum.", *gomod, len(resolved))
+	return nil
+}
+
+func modSync(args []string) error {
+	fs := flag.NewFlagSet("mod sync", flag.ExitOnError)
+	goversion := fs.String("go", "", "Go version whose stub files are read (default: the local toolchain's)")
+	gomod := fs.String("modfile", "", "go.mod to update (default: the current module's)")
+	dryRun := fs.Bool("n", false, "print the changes as a diff without writing go.mod")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), modSyncUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	data, f, err := readModFile(goversion, gomod)
+	if err != nil {
+		return err
+	}
+	pkgs, err := stubPackages(filepath.Dir(*gomod), *goversion, true, patterns...)
+	if err != nil {
+		return err
+	}
+	pins, err := collectPins(pkgs, false)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := solvePins(f, pins)
+	if err != nil {
+		return err
+	}
+	if err := applyPins(f, resolved); err != nil {
+		return err
+	}
+	prunePins(f, resolved)
+	out, err := f.Format()
+	if err != nil {
+		return err
+	}
+
+	diff := unifiedDiff(*gomod, *gomod, data, out)
+	if diff == "" {
+		log.Printf("%s is up to date (%d pins)", *gomod, len(resolved))
+		return nil
+	}
+	if *dryRun {
+		fmt.Print(diff)
+		return nil
+	}
+	if err := os.WriteFile(*gomod, out, 0644); err != nil {
+		return err
+	}
+	log.Printf("updated %s (%d pins). Run go mod tidy to update go.sum.", *gomod, len(resolved))
+	return nil
+}
+
+// readModFile reads and parses gomod, defaulting it to the current module's go.mod
+// and goversion to the local toolchain's.
+func readModFile(goversion *string, gomod *string) ([]byte, *modfile.File, error) {
+	if *goversion == "" {
+		v, err := run("", nil, "go", "env", "GOVERSION")
+		if err != nil {
+			return nil, nil, err
+		}
+		*goversion = v
+	}
+	if *gomod == "" {
+		var err error
+		if *gomod, err = goModPath(""); err != nil {
+			return nil, nil, err
+		}
+	}
+	data, err := os.ReadFile(*gomod)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := modfile.Parse(*gomod, data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, f, nil
+}
+
+// collectPins reads the pins of every package. With verbose, packages without any are logged.
+func collectPins(pkgs []listedPackage, verbose bool) ([]pin, error) {
+	pins := []pin{}
+	for _, pkg := range pkgs {
+		ps, err := readPins(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if len(ps) == 0 && verbose {
+			log.Printf("%s: no CheckDeps pins", pkg.ImportPath)
+		}
+		pins = append(pins, ps...)
+	}
+	return pins, nil
+}
+
+// solvePins solves pins for the module of f, explaining any conflicts on stderr.
+func solvePins(f *modfile.File, pins []pin) ([]resolvedPin, error) {
+	mainModule := ""
+	if f.Module != nil {
+		mainModule = f.Module.Mod.Path
+	}
+	resolved, conflicts := solve(mainModule, pins)
+	if len(conflicts) > 0 {
+		fprintConflicts(os.Stderr, conflicts, mainModule)
+		return nil, fmt.Errorf("%d dependencies can not be pinned", len(conflicts))
+	}
+	return resolved, nil
+}
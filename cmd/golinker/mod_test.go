@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestSyncPins(t *testing.T) {
+	tests := []struct {
+		name     string
+		gomod    string
+		resolved []resolvedPin
+		want     string
+	}{
+		{
+			name: "single pin line",
+			gomod: `module example.com/app
+
+go 1.22
+
+replace (
+	example.com/local => ../local
+	example.com/fork => example.com/fork2 v1.0.0
+)
+
+// Pinned by golinker stubs
+replace example.com/old => example.com/old v1.0.0
+`,
+			resolved: []resolvedPin{{Path: "example.com/new", Version: "v1.2.0", Replace: "example.com/new", Required: "v1.2.0"}},
+			want: `module example.com/app
+
+go 1.22
+
+replace (
+	example.com/local => ../local
+	example.com/fork => example.com/fork2 v1.0.0
+)
+
+// Pinned by golinker stubs
+replace example.com/new => example.com/new v1.2.0
+
+require example.com/new v1.2.0
+`,
+		},
+		{
+			name: "pin block",
+			gomod: `module example.com/app
+
+go 1.22
+
+require example.com/kept v1.0.0
+
+replace example.com/local => ../local
+
+// Pinned by golinker stubs
+replace (
+	example.com/kept => example.com/kept v1.0.0
+	example.com/old => example.com/old v1.0.0
+)
+`,
+			resolved: []resolvedPin{
+				{Path: "example.com/kept", Version: "v1.0.0", Replace: "example.com/kept", Required: "v1.0.0"},
+				{Path: "example.com/new", Version: "v1.2.0", Replace: "example.com/new", Required: "v1.2.0"},
+			},
+			want: `module example.com/app
+
+go 1.22
+
+require (
+	example.com/kept v1.0.0
+	example.com/new v1.2.0
+)
+
+replace example.com/local => ../local
+
+// Pinned by golinker stubs
+replace (
+	example.com/kept => example.com/kept v1.0.0
+	example.com/new => example.com/new v1.2.0
+)
+`,
+		},
+		{
+			name: "no pins left",
+			gomod: `module example.com/app
+
+go 1.22
+
+replace example.com/local => ../local
+
+// Pinned by golinker stubs
+replace example.com/old => example.com/old v1.0.0
+`,
+			want: `module example.com/app
+
+go 1.22
+
+replace example.com/local => ../local
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := modfile.Parse("go.mod", []byte(tt.gomod), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := applyPins(f, tt.resolved); err != nil {
+				t.Fatal(err)
+			}
+			prunePins(f, tt.resolved)
+			out, err := f.Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := unifiedDiff("want", "got", []byte(tt.want), out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const packUsage = `Usage: golinker pack [flags] <package dir>
+
+Compiles the package with each Go toolchain, compresses the object files and writes
+one Go file per Go version. Each file is constrained by the shrinkpkg<goversion> build
+tag that gorun sets and registers the objects with golinker.LoadObject.
+
+Flags:
+`
+
+// packObject is a compressed object file written next to the generated Go file.
+type packObject struct {
+	Variant string // key of the map passed to LoadObject. eg. 1.23.5/linux/amd64
+	File    string // embedded file name
+	Var     string
+}
+
+func pack(args []string) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	toolchains := fs.String("go", "go", "comma separated Go toolchains: go, a name in $GOPATH/bin or PATH (eg. go1.23.5) or a path")
+	platforms := fs.String("platform", "", "comma separated GOOS/GOARCH pairs (default: the toolchain's platform)")
+	outDir := fs.String("o", ".", "output directory (the stub package)")
+	pkgName := fs.String("pkg", "", "package name of the generated files (default: the output directory's name)")
+	fullPackageName := fs.String("name", "", "fullPackageName to register the objects with (default: the package's import path)")
+	compression := fs.String("compress", "gzip", "gzip, zstd, xz or none")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), packUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	dir := fs.Arg(0)
+
+	if _, err := compress(nil, *compression); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	if *pkgName == "" {
+		name, err := dirPackageName(*outDir)
+		if err != nil {
+			return err
+		}
+		*pkgName = name
+	}
+
+	for _, tc := range strings.Split(*toolchains, ",") {
+		goEXEPath, err := toolchainPath(strings.TrimSpace(tc))
+		if err != nil {
+			return err
+		}
+		// Queried like compile runs the toolchain, so that go.mod can not switch it
+		goversion, err := run(dir, []string{"GOTOOLCHAIN=local"}, goEXEPath, "env", "GOVERSION")
+		if err != nil {
+			return fmt.Errorf("could not find compiler: %w", err)
+		}
+
+		var targets []string
+		if *platforms == "" {
+			target, err := run(dir, []string{"GOTOOLCHAIN=local"}, goEXEPath, "env", "GOOS", "GOARCH")
+			if err != nil {
+				return err
+			}
+			targets = []string{strings.Join(strings.Fields(target), "/")}
+		} else {
+			targets = strings.Split(*platforms, ",")
+		}
+
+		name := *fullPackageName
+		objects := []packObject{}
+		for i, target := range targets {
+			goos, goarch, ok := strings.Cut(strings.TrimSpace(target), "/")
+			if !ok {
+				return fmt.Errorf("invalid platform %q: expected GOOS/GOARCH", target)
+			}
+			importPath, data, err := compile(goEXEPath, dir, goos, goarch)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				name = importPath
+			}
+			data, err = compress(data, *compression)
+			if err != nil {
+				return err
+			}
+
+			o := packObject{
+				Variant: strings.TrimPrefix(goversion, "go") + "/" + goos + "/" + goarch,
+				File:    fmt.Sprintf("%s_%s_%s_%s.o%s", path.Base(name), goversion, goos, goarch, extension(*compression)),
+				Var:     fmt.Sprintf("object%d", i),
+			}
+			if err := os.WriteFile(filepath.Join(*outDir, o.File), data, 0644); err != nil {
+				return err
+			}
+			objects = append(objects, o)
+		}
+
+		file := filepath.Join(*outDir, fmt.Sprintf("%s_%s.go", path.Base(name), goversion))
+		if err := writePackFile(file, *pkgName, goversion, name, objects); err != nil {
+			return err
+		}
+		log.Printf("%s: wrote %s (%d objects)", goversion, file, len(objects))
+	}
+	return nil
+}
+
+// dirPackageName returns the default package name of the files written to dir: its base name.
+// pack and stub write into the same stub package, so they must agree.
+func dirPackageName(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(filepath.Base(abs), "-", "_"), nil
+}
+
+// toolchainPath finds a Go toolchain. Names such as go1.23.5 are looked up in $GOPATH/bin
+// (where golang.org/dl installs them) and then PATH.
+func toolchainPath(name string) (string, error) {
+	if name == "go" || strings.ContainsAny(name, `/\`) {
+		return name, nil
+	}
+	exe := name
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if gopath, err := run("", nil, "go", "env", "GOPATH"); err == nil {
+		for _, p := range filepath.SplitList(gopath) {
+			if _, err := os.Stat(filepath.Join(p, "bin", exe)); err == nil {
+				return filepath.Join(p, "bin", exe), nil
+			}
+		}
+	}
+	return name, nil
+}
+
+// compile builds the package in dir into an object file and returns its import path and contents.
+func compile(goEXEPath string, dir string, goos string, goarch string) (string, []byte, error) {
+	env := []string{"GOOS=" + goos, "GOARCH=" + goarch, "GOTOOLCHAIN=local"}
+	list, err := run(dir, env, goEXEPath, "list", "-f", "{{.ImportPath}} {{.Name}}", ".")
+	if err != nil {
+		return "", nil, err
+	}
+	importPath, name, _ := strings.Cut(list, " ")
+	if name == "main" {
+		return "", nil, fmt.Errorf("%s: can not pack package main", importPath)
+	}
+
+	tmp, err := os.MkdirTemp("", "golinker-pack")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tmp)
+	objpath := filepath.Join(tmp, "object.a")
+	if _, err := run(dir, env, goEXEPath, "build", "-buildmode=archive", "-trimpath", "-o", objpath, "."); err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(objpath)
+	return importPath, data, err
+}
+
+// compress compresses an object file with a format golinker detects from its magic bytes.
+func compress(data []byte, compression string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch compression {
+	case "none":
+		return data, nil
+	case "gzip":
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case "zstd":
+		w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case "xz":
+		w, err := xz.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown compression: " + compression)
+	}
+	return buf.Bytes(), nil
+}
+
+func extension(compression string) string {
+	switch compression {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	case "xz":
+		return ".xz"
+	}
+	return ""
+}
+
+var packTemplate = template.Must(template.New("pack").Parse(`// Code generated by golinker pack. DO NOT EDIT.
+
+//go:build shrinkpkg{{.GoVersion}}
+
+package {{.Package}}
+
+import (
+	_ "embed"
+
+	"github.com/romance-dev/golinker"
+)
+{{range .Objects}}
+//go:embed {{.File}}
+var {{.Var}} []byte
+{{end}}
+func init() {
+	golinker.LoadObject({{printf "%q" .Name}}, map[string][]byte{
+{{- range .Objects}}
+		{{printf "%q" .Variant}}: {{.Var}},
+{{- end}}
+	})
+}
+`))
+
+// writePackFile writes the Go file that registers the objects of one Go version.
+func writePackFile(file string, pkgName string, goversion string, fullPackageName string, objects []packObject) error {
+	var buf bytes.Buffer
+	err := packTemplate.Execute(&buf, map[string]interface{}{
+		"GoVersion": goversion,
+		"Package":   pkgName,
+		"Name":      fullPackageName,
+		"Objects":   objects,
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, src, 0644)
+}
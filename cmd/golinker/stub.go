@@ -0,0 +1,739 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const stubUsage = `Usage: golinker stub [flags] <package dir>
+
+Reads the exported API of a package with go/types and writes a stub package that
+loads it with golinker: a Load call with a Var for every exported variable, a
+SymbolPtr wrapper for every exported function and method, a layout-compatible
+declaration of every exported type and constant, and an init that calls
+GoVersionCheck, CheckDeps and RegTypes.
+
+One file is written per Go version, constrained by the same shrinkpkg<goversion>
+build tag as the files written by golinker pack. Generic functions and types can
+not be called through an object file and are skipped. Functions, methods, variables
+and aliases that refer to unexported types of the package are skipped and listed.
+
+RegTypes lists the types of other packages used by the API, so that the object
+shares their type descriptors with the executable. The stub's own types are not
+listed: they belong to the stub package, while the object refers to the types of
+fullPackageName, which only the object itself defines.
+
+Flags:
+`
+
+type stubDecl struct {
+	Doc  string
+	Decl string
+}
+
+type stubFunc struct {
+	Doc      string
+	Recv     string // eg. "(r *T) "
+	Name     string
+	Params   string
+	Results  string
+	Symbol   string // appended to fullPackageName. eg. ".(*T).M"
+	FuncType string
+	Args     string
+	Return   bool
+}
+
+type stubFile struct {
+	GoVersion       string
+	PackageDoc      string
+	Package         string
+	FullPackageName string
+	Module          string
+	Pattern         string
+	Imports         []string
+	Deps            []string
+	RegTypes        []string
+	Consts          []stubDecl
+	Types           []stubDecl
+	Vars            []stubDecl
+	VarNames        []string
+	Funcs           []stubFunc
+}
+
+func stub(args []string) error {
+	fs := flag.NewFlagSet("stub", flag.ExitOnError)
+	goversions := fs.String("go", "", "comma separated Go versions to write stubs for (default: the local toolchain's)")
+	outDir := fs.String("o", ".", "output directory (the stub package)")
+	pkgName := fs.String("pkg", "", "package name of the stub (default: the output directory's name)")
+	fullPackageName := fs.String("name", "", "fullPackageName the objects are registered with (default: the package's import path)")
+	pattern := fs.String("pattern", "%s_ptr", "fmt pattern naming the accessor function of each exported variable")
+	accessors := fs.Bool("accessors", false, "write missing variable accessors into the package (run before golinker pack)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), stubUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	dir := fs.Arg(0)
+
+	if *goversions == "" {
+		v, err := run("", nil, "go", "env", "GOVERSION")
+		if err != nil {
+			return err
+		}
+		*goversions = v
+	}
+
+	list, err := run(dir, nil, "go", "list", "-f", "{{.ImportPath}}\n{{.Module.Path}}\n{{.Dir}}\n{{join .GoFiles \" \"}}", ".")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(list, "\n")
+	if len(lines) != 4 {
+		return fmt.Errorf("%s: unexpected go list output", dir)
+	}
+	importPath, module, pkgDir, goFiles := lines[0], lines[1], lines[2], strings.Fields(lines[3])
+	if *fullPackageName == "" {
+		*fullPackageName = importPath
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, name := range goFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(importPath, fset, files, nil)
+	if err != nil {
+		return err
+	}
+
+	deps, err := stubDeps(dir)
+	if err != nil {
+		return err
+	}
+
+	g := newStubGenerator(pkg, docs(files))
+	file := g.generate(*pattern)
+	file.PackageDoc = packageDoc(files)
+	file.Package = *pkgName
+	if file.Package == "" {
+		if file.Package, err = dirPackageName(*outDir); err != nil {
+			return err
+		}
+	}
+	file.FullPackageName = *fullPackageName
+	file.Module = module
+	file.Deps = deps
+
+	if len(g.skipped) > 0 {
+		log.Printf("skipped declarations that refer to unexported types: %s", strings.Join(g.skipped, ", "))
+	}
+	if len(g.missing) > 0 {
+		if !*accessors {
+			log.Printf("skipped variables without an accessor (use -accessors): %s", strings.Join(g.missing, ", "))
+		} else {
+			for _, name := range g.missing {
+				if accessor := fmt.Sprintf(*pattern, name); pkg.Scope().Lookup(accessor) != nil {
+					return fmt.Errorf("%s: %s is declared but is not a func() unsafe.Pointer", importPath, accessor)
+				}
+			}
+			name := filepath.Join(pkgDir, "golinker_accessors.go")
+			if err := writeAccessors(name, pkg.Name(), *pattern, g.missing); err != nil {
+				return err
+			}
+			log.Printf("wrote %s", name)
+		}
+	}
+	if *accessors {
+		for _, name := range g.missing {
+			file.Vars = append(file.Vars, stubDecl{Doc: g.doc(name), Decl: name + " *" + g.typeString(pkg.Scope().Lookup(name).Type())})
+			file.VarNames = append(file.VarNames, name)
+		}
+	}
+	file.RegTypes = g.regTypeList()
+	file.Imports = g.imports()
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	for _, goversion := range strings.Split(*goversions, ",") {
+		file.GoVersion = strings.TrimSpace(goversion)
+		name := filepath.Join(*outDir, fmt.Sprintf("%s_stub_%s.go", filepath.Base(pkgDir), file.GoVersion))
+		if err := writeStubFile(name, file); err != nil {
+			return err
+		}
+		log.Printf("%s: wrote %s", file.GoVersion, name)
+	}
+	return nil
+}
+
+// stubDeps returns the modules the package depends on in the form expected by golinker.CheckDeps.
+func stubDeps(dir string) ([]string, error) {
+	list, err := run(dir, nil, "go", "list", "-deps", "-f",
+		"{{with .Module}}{{if not .Main}}{{.Path}}::{{.Version}}"+
+			"{{with .Replace}}=>{{.Path}}::{{.Version}}{{with .Sum}}::{{.}}{{end}}{{else}}{{with .Sum}}::{{.}}{{end}}{{end}}"+
+			"{{end}}{{end}}", ".")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	deps := []string{}
+	for _, dep := range strings.Fields(list) {
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		if strings.HasSuffix(dep, "::") {
+			log.Printf("skipped dependency replaced by a directory: %s", dep)
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+type stubGenerator struct {
+	pkg      *types.Package
+	docs     map[string]string // "Name" or "Type.Method" => doc comment
+	aliases  map[string]string // import path => name
+	regTypes map[string]bool
+	missing  []string // exported variables without an accessor
+	skipped  []string // exported declarations that refer to unexported types
+}
+
+func newStubGenerator(pkg *types.Package, docs map[string]string) *stubGenerator {
+	return &stubGenerator{
+		pkg:      pkg,
+		docs:     docs,
+		aliases:  map[string]string{},
+		regTypes: map[string]bool{},
+	}
+}
+
+// generate collects the declarations of the stub.
+func (g *stubGenerator) generate(pattern string) *stubFile {
+	file := &stubFile{Pattern: pattern}
+	scope := g.pkg.Scope()
+
+	accessors := map[string]bool{}
+	for _, name := range scope.Names() {
+		if v, ok := scope.Lookup(name).(*types.Var); ok && v.Exported() {
+			accessors[fmt.Sprintf(pattern, name)] = true
+		}
+	}
+
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Const:
+			decl := name
+			if basic, ok := obj.Type().(*types.Basic); !ok || basic.Info()&types.IsUntyped == 0 {
+				decl += " " + g.opaqueType(obj.Type())
+			}
+			file.Consts = append(file.Consts, stubDecl{Doc: g.doc(name), Decl: decl + " = " + constString(obj.Val())})
+		case *types.TypeName:
+			if obj.IsAlias() && g.usesUnexported(obj.Type()) {
+				g.skipped = append(g.skipped, name)
+				continue
+			}
+			if decl, ok := g.typeDecl(obj); ok {
+				file.Types = append(file.Types, stubDecl{Doc: g.doc(name), Decl: decl})
+			}
+			if named, ok := obj.Type().(*types.Named); ok && !obj.IsAlias() && named.TypeParams().Len() == 0 {
+				for i := 0; i < named.NumMethods(); i++ {
+					m := named.Method(i)
+					switch {
+					case !m.Exported():
+					case g.usesUnexported(m.Type()):
+						g.skipped = append(g.skipped, name+"."+m.Name())
+					default:
+						file.Funcs = append(file.Funcs, g.method(named, m))
+					}
+				}
+			}
+		case *types.Var:
+			if g.usesUnexported(obj.Type()) {
+				g.skipped = append(g.skipped, name)
+				continue
+			}
+			if !g.hasAccessor(fmt.Sprintf(pattern, name)) {
+				g.missing = append(g.missing, name)
+				continue
+			}
+			file.Vars = append(file.Vars, stubDecl{Doc: g.doc(name), Decl: name + " *" + g.typeString(obj.Type())})
+			file.VarNames = append(file.VarNames, name)
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+			if accessors[name] || sig.TypeParams().Len() > 0 {
+				continue
+			}
+			if g.usesUnexported(sig) {
+				g.skipped = append(g.skipped, name)
+				continue
+			}
+			file.Funcs = append(file.Funcs, g.function(name, "", "."+name, nil, sig))
+		}
+	}
+	return file
+}
+
+// regTypeList returns the arguments to RegTypes for the types of other packages used so far.
+func (g *stubGenerator) regTypeList() []string {
+	list := []string{}
+	for t := range g.regTypes {
+		list = append(list, "(*"+t+")(nil)")
+	}
+	sort.Strings(list)
+	return list
+}
+
+// constString formats a constant value as a Go expression with the same exact value.
+func constString(v constant.Value) string {
+	s := v.ExactString()
+	if num, den, ok := strings.Cut(s, "/"); ok && v.Kind() == constant.Float {
+		return num + ".0 / " + den // rational
+	}
+	return s
+}
+
+// hasAccessor reports whether the package declares name as a func() unsafe.Pointer.
+func (g *stubGenerator) hasAccessor(name string) bool {
+	fn, ok := g.pkg.Scope().Lookup(name).(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		types.Identical(sig.Results().At(0).Type(), types.Typ[types.UnsafePointer])
+}
+
+// typeDecl returns the declaration of an exported type that is layout-compatible with
+// the original. The parts of a type that reference unexported types of the package are
+// made opaque (see opaqueType).
+func (g *stubGenerator) typeDecl(obj *types.TypeName) (string, bool) {
+	if obj.IsAlias() {
+		return obj.Name() + " = " + g.typeString(types.Unalias(obj.Type())), true
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return "", false
+	}
+	if !g.usesUnexported(named.Underlying()) {
+		return obj.Name() + " " + g.typeString(named.Underlying()), true
+	}
+
+	return obj.Name() + " " + g.opaqueType(named.Underlying()), true
+}
+
+// opaqueType returns a type with the same size, alignment and pointer words as t on every
+// platform that does not reference the unexported types of the package. Pointers, maps,
+// channels and funcs become unsafe.Pointer and the fields that can not be kept become blank,
+// so that the garbage collector still sees every pointer the object's code stores.
+func (g *stubGenerator) opaqueType(t types.Type) string {
+	if !g.usesUnexported(t) {
+		return g.typeString(t)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return g.typeString(u)
+	case *types.Struct:
+		fields := []string{}
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			switch {
+			case !f.Exported() || g.usesUnexported(f.Type()):
+				fields = append(fields, "_ "+g.opaqueType(f.Type()))
+			case f.Embedded():
+				fields = append(fields, g.typeString(f.Type()))
+			default:
+				fields = append(fields, f.Name()+" "+g.typeString(f.Type()))
+			}
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+	case *types.Array:
+		return fmt.Sprintf("[%d]%s", u.Len(), g.opaqueType(u.Elem()))
+	case *types.Slice:
+		return "struct {\n_ " + g.unsafePointer() + "\n_, _ int\n}"
+	case *types.Interface:
+		return "[2]" + g.unsafePointer() // type or itab, and data
+	default: // pointer, map, chan or func
+		return g.unsafePointer()
+	}
+}
+
+// unsafePointer imports package unsafe and returns its Pointer type.
+func (g *stubGenerator) unsafePointer() string {
+	return g.typeString(types.Typ[types.UnsafePointer])
+}
+
+// usesUnexported reports whether t refers to an unexported type of the package.
+func (g *stubGenerator) usesUnexported(t types.Type) bool {
+	found := false
+	walk(t, map[types.Type]bool{}, func(named *types.Named) {
+		if named.Obj().Pkg() == g.pkg && !named.Obj().Exported() {
+			found = true
+		}
+	})
+	if iface, ok := t.(*types.Interface); ok {
+		for i := 0; i < iface.NumMethods(); i++ {
+			if !iface.Method(i).Exported() {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// walk calls fn for every named type that t is composed of.
+func walk(t types.Type, seen map[types.Type]bool, fn func(*types.Named)) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	switch t := t.(type) {
+	case *types.Alias:
+		walk(types.Unalias(t), seen, fn)
+	case *types.Named:
+		fn(t)
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			walk(t.TypeArgs().At(i), seen, fn)
+		}
+	case *types.Pointer:
+		walk(t.Elem(), seen, fn)
+	case *types.Slice:
+		walk(t.Elem(), seen, fn)
+	case *types.Array:
+		walk(t.Elem(), seen, fn)
+	case *types.Chan:
+		walk(t.Elem(), seen, fn)
+	case *types.Map:
+		walk(t.Key(), seen, fn)
+		walk(t.Elem(), seen, fn)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			walk(t.Field(i).Type(), seen, fn)
+		}
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				walk(tuple.At(i).Type(), seen, fn)
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			walk(t.Method(i).Type(), seen, fn)
+		}
+	}
+}
+
+// method returns the wrapper of a method. The receiver is passed as the first argument.
+func (g *stubGenerator) method(named *types.Named, m *types.Func) stubFunc {
+	sig := m.Type().(*types.Signature)
+	recvType := sig.Recv().Type()
+	symbol := "." + named.Obj().Name() + "." + m.Name()
+	if _, ok := recvType.(*types.Pointer); ok {
+		symbol = ".(*" + named.Obj().Name() + ")." + m.Name()
+	}
+	f := g.function(m.Name(), named.Obj().Name()+"."+m.Name(), symbol, recvType, sig)
+	f.Recv = "(r " + g.typeString(recvType) + ") "
+	return f
+}
+
+// function returns the wrapper of a function. recv is nil for functions.
+func (g *stubGenerator) function(name string, docKey string, symbol string, recv types.Type, sig *types.Signature) stubFunc {
+	if docKey == "" {
+		docKey = name
+	}
+	f := stubFunc{Doc: g.doc(docKey), Name: name, Symbol: symbol, Return: sig.Results().Len() > 0}
+
+	params, paramTypes, args := []string{}, []string{}, []string{}
+	if recv != nil {
+		paramTypes = append(paramTypes, g.typeString(recv))
+		args = append(args, "r")
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		t := g.typeString(sig.Params().At(i).Type())
+		arg := "a" + strconv.Itoa(i)
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			t = "..." + strings.TrimPrefix(t, "[]")
+			args = append(args, arg+"...")
+		} else {
+			args = append(args, arg)
+		}
+		params = append(params, arg+" "+t)
+		paramTypes = append(paramTypes, t)
+	}
+	results := []string{}
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, g.typeString(sig.Results().At(i).Type()))
+	}
+
+	f.Params = strings.Join(params, ", ")
+	f.Args = strings.Join(args, ", ")
+	switch len(results) {
+	case 0:
+	case 1:
+		f.Results = results[0]
+	default:
+		f.Results = "(" + strings.Join(results, ", ") + ")"
+	}
+	f.FuncType = strings.TrimSpace("func(" + strings.Join(paramTypes, ", ") + ") " + f.Results)
+	return f
+}
+
+// typeString formats t for the stub package. Types of other packages are imported
+// and registered with RegTypes so the object shares the host's type descriptors.
+func (g *stubGenerator) typeString(t types.Type) string {
+	walk(t, map[types.Type]bool{}, func(named *types.Named) {
+		obj := named.Obj()
+		if obj.Pkg() != nil && obj.Pkg() != g.pkg && obj.Exported() && named.TypeArgs().Len() == 0 {
+			g.regTypes[g.alias(obj.Pkg())+"."+obj.Name()] = true
+		}
+	})
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		return g.alias(p)
+	})
+}
+
+func (g *stubGenerator) alias(p *types.Package) string {
+	if alias, ok := g.aliases[p.Path()]; ok {
+		return alias
+	}
+	alias := p.Name()
+	taken := func(a string) bool {
+		if a == "golinker" || a == g.pkg.Name() {
+			return true
+		}
+		for _, v := range g.aliases {
+			if v == a {
+				return true
+			}
+		}
+		return false
+	}
+	for n := 2; taken(alias); n++ {
+		alias = p.Name() + strconv.Itoa(n)
+	}
+	g.aliases[p.Path()] = alias
+	return alias
+}
+
+// imports returns the import specs of every package referenced by the stub,
+// standard library first. An empty spec separates the groups.
+func (g *stubGenerator) imports() []string {
+	std, other := []string{}, []string{strconv.Quote(golinkerImportPath)}
+	for path, alias := range g.aliases {
+		spec := strconv.Quote(path)
+		if path != alias && !strings.HasSuffix(path, "/"+alias) {
+			spec = alias + " " + spec
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	if len(std) == 0 {
+		return other
+	}
+	return append(append(std, ""), other...)
+}
+
+func (g *stubGenerator) doc(key string) string {
+	return g.docs[key]
+}
+
+// docs returns the doc comments of the exported declarations, formatted as // comments.
+func docs(files []*ast.File) map[string]string {
+	m := map[string]string{}
+	add := func(key string, groups ...*ast.CommentGroup) {
+		for _, cg := range groups {
+			if cg != nil {
+				m[key] = comment(cg.Text())
+				return
+			}
+		}
+	}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				key := decl.Name.Name
+				if decl.Recv != nil && len(decl.Recv.List) == 1 {
+					recv := decl.Recv.List[0].Type
+					if star, ok := recv.(*ast.StarExpr); ok {
+						recv = star.X
+					}
+					if ident, ok := recv.(*ast.Ident); ok {
+						key = ident.Name + "." + key
+					}
+				}
+				add(key, decl.Doc)
+			case *ast.GenDecl:
+				var declDoc *ast.CommentGroup
+				if len(decl.Specs) == 1 {
+					declDoc = decl.Doc
+				}
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name.Name, spec.Doc, declDoc)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							add(name.Name, spec.Doc, declDoc)
+						}
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+func packageDoc(files []*ast.File) string {
+	for _, f := range files {
+		if f.Doc != nil {
+			return comment(f.Doc.Text())
+		}
+	}
+	return ""
+}
+
+// comment formats text as a // comment ending in a newline.
+func comment(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			b.WriteString("//\n")
+		} else {
+			b.WriteString("// " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+var stubTemplate = template.Must(template.New("stub").Parse(`// Code generated by golinker stub. DO NOT EDIT.
+
+//go:build shrinkpkg{{.GoVersion}}
+
+{{.PackageDoc}}package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+
+const fullPackageName = {{printf "%q" .FullPackageName}}
+
+var codeModule = golinker.Load(fullPackageName, {{printf "%q" .Pattern}},
+{{- range .VarNames}}
+	golinker.Var{Name: {{printf "%q" .}}, Ptr: golinker.Ptr(&{{.}})},
+{{- end}}
+)
+
+func init() {
+	golinker.GoVersionCheck({{printf "%q" .Module}}, {{printf "%q" .GoVersion}})
+{{- if .Deps}}
+	golinker.CheckDeps({{printf "%q" .Module}},
+{{- range .Deps}}
+		{{printf "%q" .}},
+{{- end}}
+	)
+{{- end}}
+{{- if .RegTypes}}
+	golinker.RegTypes(
+{{- range .RegTypes}}
+		{{.}},
+{{- end}}
+	)
+{{- end}}
+}
+{{range .Consts}}
+{{.Doc}}const {{.Decl}}
+{{end}}
+{{- range .Types}}
+{{.Doc}}type {{.Decl}}
+{{end}}
+{{- range .Vars}}
+{{.Doc}}var {{.Decl}}
+{{end}}
+{{- range .Funcs}}
+{{.Doc}}func {{.Recv}}{{.Name}}({{.Params}}) {{.Results}} {
+	f := golinker.SymbolPtr(fullPackageName+{{printf "%q" .Symbol}}, codeModule())
+	{{if .Return}}return {{end}}(*(*{{.FuncType}})(f))({{.Args}})
+}
+{{end}}`))
+
+// writeStubFile writes one version of the stub package.
+func writeStubFile(name string, file *stubFile) error {
+	var buf bytes.Buffer
+	if err := stubTemplate.Execute(&buf, file); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return os.WriteFile(name, src, 0644)
+}
+
+var accessorTemplate = template.Must(template.New("accessors").Parse(`// Code generated by golinker stub. DO NOT EDIT.
+
+package {{.Package}}
+
+import "unsafe"
+{{range .Accessors}}
+// {{.Func}} returns the address of {{.Var}} for golinker.
+func {{.Func}}() unsafe.Pointer { return unsafe.Pointer(&{{.Var}}) }
+{{end}}`))
+
+// writeAccessors writes the accessor functions of variables into the original package.
+func writeAccessors(name string, pkgName string, pattern string, vars []string) error {
+	type accessor struct{ Func, Var string }
+	accessors := []accessor{}
+	for _, v := range vars {
+		accessors = append(accessors, accessor{Func: fmt.Sprintf(pattern, v), Var: v})
+	}
+	var buf bytes.Buffer
+	err := accessorTemplate.Execute(&buf, map[string]interface{}{"Package": pkgName, "Accessors": accessors})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, src, 0644)
+}
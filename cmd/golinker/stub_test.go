@@ -0,0 +1,158 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const stubTestPackage = `// Package lib exercises golinker stub.
+package lib
+
+import (
+	"time"
+	"unsafe"
+)
+
+type inner struct{ n int }
+
+type kind int
+
+// K has an unexported type.
+const K kind = 2
+
+const N = 3
+
+// T has an unexported field.
+type T struct {
+	Name string
+	in   *inner
+	D    time.Duration
+}
+
+type Inner = inner
+
+type Exported = T
+
+var V int
+
+func V_ptr() unsafe.Pointer { return unsafe.Pointer(&V) }
+
+var Hidden *inner
+
+func Hidden_ptr() unsafe.Pointer { return unsafe.Pointer(&Hidden) }
+
+func New() *inner { return &inner{} }
+
+func Make(d time.Duration) T { return T{D: d} }
+
+func Sum(xs ...int) int { return len(xs) }
+
+func Map[K comparable](k K) K { return k }
+
+func (t *T) Get() string { return t.Name }
+
+func (t T) Use(i *inner) {}
+`
+
+// TestStubTypeChecks generates the stub of a package and type-checks it against golinker.
+func TestStubTypeChecks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "libstub")
+	writeFile(t, filepath.Join(dir, "lib", "go.mod"), "module example.com/lib\n\ngo 1.22\n")
+	writeFile(t, filepath.Join(dir, "lib", "lib.go"), stubTestPackage)
+	if err := stub([]string{"-o", out, "-go", "go1.22.0", filepath.Join(dir, "lib")}); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(out, "lib_stub_go1.22.0.go")
+	src, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: &stubImporter{fset: fset, std: importer.ForCompiler(fset, "source", nil)}}
+	pkg, err := conf.Check("example.com/libstub", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+
+	for _, name := range []string{"K", "N", "T", "Exported", "V", "Make", "Sum"} {
+		if pkg.Scope().Lookup(name) == nil {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	for _, name := range []string{"Inner", "Hidden", "New", "Map"} {
+		if pkg.Scope().Lookup(name) != nil {
+			t.Errorf("%s is not skipped", name)
+		}
+	}
+	T := pkg.Scope().Lookup("T").Type()
+	if obj, _, _ := types.LookupFieldOrMethod(T, true, pkg, "Use"); obj != nil {
+		t.Error("T.Use is not skipped")
+	}
+	if obj, _, _ := types.LookupFieldOrMethod(T, true, pkg, "Get"); obj == nil {
+		t.Error("T.Get is missing")
+	}
+}
+
+func writeFile(t *testing.T, name string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stubImporter imports golinker from the source of this module and the standard library
+// from GOROOT. The other dependencies of golinker are left empty, so only the API that
+// stubs use is checked.
+type stubImporter struct {
+	fset     *token.FileSet
+	std      types.Importer
+	golinker *types.Package
+}
+
+func (imp *stubImporter) Import(path string) (*types.Package, error) {
+	if path == golinkerImportPath {
+		return imp.importGolinker()
+	}
+	if strings.Contains(strings.Split(path, "/")[0], ".") {
+		return types.NewPackage(path, filepath.Base(path)), nil
+	}
+	return imp.std.Import(path)
+}
+
+func (imp *stubImporter) importGolinker() (*types.Package, error) {
+	if imp.golinker != nil {
+		return imp.golinker, nil
+	}
+	bp, err := build.ImportDir(filepath.Join("..", ".."), 0)
+	if err != nil {
+		return nil, err
+	}
+	files := []*ast.File{}
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(imp.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: imp, Error: func(error) {}} // the dependencies are empty
+	imp.golinker, _ = conf.Check(golinkerImportPath, imp.fset, files, nil)
+	return imp.golinker, nil
+}
@@ -0,0 +1,215 @@
+package golinker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/romance-dev/golinker/internal/depspec"
+)
+
+// DepConflict is a dependency that two or more modules require to be built from different source.
+type DepConflict struct {
+	Path    string
+	Modules []string // modules requiring the dependency
+	Deps    []Dep    // what each of Modules requires
+}
+
+// VerifyReport is the result of VerifyAll. It is returned as the Cause of an
+// ErrDepMismatch error and can be extracted with errors.As.
+type VerifyReport struct {
+	Modules   []*DepReport  // one per module in the order CheckDeps was called
+	Conflicts []DepConflict // sorted by Path
+}
+
+// OK reports whether every dependency matches and no modules conflict.
+func (r *VerifyReport) OK() bool {
+	for _, m := range r.Modules {
+		if !m.OK() {
+			return false
+		}
+	}
+	return len(r.Conflicts) == 0
+}
+
+func (r *VerifyReport) Error() string {
+	bad := []string{}
+	for _, m := range r.Modules {
+		if !m.OK() {
+			bad = append(bad, m.Module+": "+m.Error())
+		}
+	}
+	for _, c := range r.Conflicts {
+		required := []string{}
+		for i, m := range c.Modules {
+			required = append(required, m+" requires "+c.Deps[i].requirement())
+		}
+		bad = append(bad, fmt.Sprintf("%s (conflict: %s)", c.Path, strings.Join(required, ", ")))
+	}
+	return strings.Join(bad, "; ")
+}
+
+// GoMod returns require and replace directives that pin the dependencies of every module.
+// It returns "" if the modules conflict.
+func (r *VerifyReport) GoMod() string {
+	if len(r.Conflicts) > 0 {
+		return ""
+	}
+	modules := []string{}
+	deps := []Dep{}
+	seen := map[string]bool{}
+	for _, m := range r.Modules {
+		modules = append(modules, m.Module)
+		for _, d := range m.Deps {
+			if !seen[d.Path] {
+				seen[d.Path] = true
+				deps = append(deps, d)
+			}
+		}
+	}
+	return goMod(strings.Join(modules, ", "), deps)
+}
+
+// Fprint writes a table per mismatched module, the conflicts between modules
+// and a sample go.mod if one exists.
+func (r *VerifyReport) Fprint(w io.Writer) {
+	fprintDepHeader(w)
+	for _, m := range r.Modules {
+		if !m.OK() {
+			m.fprintTable(w)
+			fmt.Fprintln(w, "")
+		}
+	}
+
+	if len(r.Conflicts) > 0 {
+		fmt.Fprintln(w, "Modules requiring the same dependency built from different source:")
+		table := tablewriter.NewWriter(w)
+		table.SetAutoWrapText(false)
+		table.SetAutoMergeCells(true)
+		table.SetHeader([]string{"Dep", "Module", "Required"})
+		for _, c := range r.Conflicts {
+			for i, m := range c.Modules {
+				table.Append([]string{c.Path, m, c.Deps[i].requirement()})
+			}
+		}
+		table.Render()
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, "No go.mod satisfies every module: the vendors must agree on the conflicting dependencies.")
+		return
+	}
+
+	fmt.Fprintln(w, "sample go.mod:")
+	fmt.Fprintln(w, r.GoMod())
+}
+
+// requirement describes what the dependency must be built from.
+func (d Dep) requirement() string {
+	s := d.Required
+	if d.Replace != "" && d.Replace != d.Path {
+		s = d.Replace + " " + s
+	}
+	if d.Sum != "" {
+		s += " " + d.Sum
+	}
+	return s
+}
+
+// SameSource reports whether d and other can be satisfied by the same module:
+// they are built from the same module path at the same version (or commit), and
+// their go.sum hashes agree if both declare one.
+func (d Dep) SameSource(other Dep) bool {
+	return depspec.SameSource(d.spec(), other.spec())
+}
+
+// VerifyAll verifies the dependencies recorded by every CheckDeps call so far, both
+// against the executable and against each other. If anything does not match, the error
+// wraps ErrDepMismatch with a *VerifyReport as its Cause.
+//
+// It is called automatically before object files are linked. If it fails, the link
+// returns its error and the object files stay pending. Calling it explicitly takes over
+// handling of the requirements recorded so far, so that the next link proceeds.
+func VerifyAll() error {
+	return Default.VerifyAll()
+}
+
+// VerifyAll verifies the dependencies recorded by every call to l.CheckDeps so far.
+func (l *Linker) VerifyAll() error {
+	l.depMu.Lock()
+	defer l.depMu.Unlock()
+	l.requirementsChecked = len(l.requirements)
+	return l.verifyAll()
+}
+
+// verifyAll implements VerifyAll. depMu must be held.
+func (l *Linker) verifyAll() error {
+	report := &VerifyReport{}
+	for _, m := range l.requirements {
+		// A module with several stub packages calls CheckDeps once per package
+		dup := false
+		for _, prev := range report.Modules {
+			if prev.Module == m.Module && reflect.DeepEqual(prev.Deps, m.Deps) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			report.Modules = append(report.Modules, m)
+		}
+	}
+
+	type requirement struct {
+		module string
+		dep    Dep
+	}
+	byPath := map[string][]requirement{}
+	for _, m := range report.Modules {
+		for _, d := range m.Deps {
+			byPath[d.Path] = append(byPath[d.Path], requirement{m.Module, d})
+		}
+	}
+	for path, reqs := range byPath {
+		conflict := false
+		for i := range reqs {
+			for j := i + 1; j < len(reqs) && !conflict; j++ {
+				conflict = !reqs[i].dep.SameSource(reqs[j].dep)
+			}
+		}
+		if conflict {
+			c := DepConflict{Path: path}
+			for _, req := range reqs {
+				c.Modules = append(c.Modules, req.module)
+				c.Deps = append(c.Deps, req.dep)
+			}
+			report.Conflicts = append(report.Conflicts, c)
+		}
+	}
+	sort.Slice(report.Conflicts, func(i, j int) bool { return report.Conflicts[i].Path < report.Conflicts[j].Path })
+
+	if !report.OK() {
+		return &Error{Err: ErrDepMismatch, Cause: report}
+	}
+	return nil
+}
+
+// checkDeps returns the errors recorded by GoVersionCheck, then verifies the dependencies
+// recorded since the last successful check.
+// On failure they stay unchecked, so every link fails until VerifyAll is called.
+func (l *Linker) checkDeps() error {
+	l.depMu.Lock()
+	defer l.depMu.Unlock()
+	if len(l.goVersionErrs) > 0 {
+		return errors.Join(l.goVersionErrs...)
+	}
+	if l.requirementsChecked == len(l.requirements) {
+		return nil
+	}
+	if err := l.verifyAll(); err != nil {
+		return err
+	}
+	l.requirementsChecked = len(l.requirements)
+	return nil
+}
@@ -2,172 +2,332 @@ package golinker
 
 import (
 	"bytes"
-	"encoding/hex"
 	"fmt"
-	"golang.org/x/mod/modfile"
-	"golang.org/x/mod/semver"
-	"os"
+	"io"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/olekukonko/tablewriter"
+	"github.com/romance-dev/golinker/internal/depspec"
+	"golang.org/x/mod/modfile"
 )
 
-var onceDeps sync.Once
-var deps map[string]string
-
-// extractVersion returns the version tag or commit hash
-func extractVersion(version string) string {
-	// Check version type
-	// 1. v1.2 (tag)
-	// 2. v6.0.0-20250303095825-24047e466509 (psuedo)
-	splits := strings.Split(version, "-")
-	if len(splits) == 3 && semver.IsValid(splits[0]) {
-		if _, err := time.Parse("20060102150405", splits[1]); err == nil {
-			// valid timestamp
-			if _, err := hex.DecodeString(splits[2]); err == nil {
-				// valid sha
-				return splits[2]
-			}
+// DepStatus is the result of comparing a required dependency with the executable.
+type DepStatus int
+
+const (
+	DepMatch       DepStatus = iota // the executable has the exact version
+	DepMismatch                     // the executable has a different version
+	DepMissing                      // the executable does not contain the module
+	DepReplaced                     // the executable replaces the module with another module or a directory
+	DepSumMismatch                  // the versions match but the executable was built from different source
+)
+
+func (s DepStatus) String() string {
+	switch s {
+	case DepMatch:
+		return "match"
+	case DepMismatch:
+		return "mismatch"
+	case DepMissing:
+		return "missing"
+	case DepReplaced:
+		return "replaced"
+	case DepSumMismatch:
+		return "sum mismatch"
+	}
+	return "DepStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Dep is a dependency required by a module together with what the executable contains.
+type Dep struct {
+	Path     string // module path
+	Version  string // version required by the module
+	Replace  string // module path the dependency must be replaced with. "" if none.
+	Required string // exact version required (of Replace if set)
+	Sum      string // go.sum hash (h1:...) of the required module (of Replace if set). "" if not declared.
+
+	Current        string // version in the executable. "" if missing or replaced by a directory.
+	CurrentReplace string // module path or directory the executable replaces it with. "" if none.
+	CurrentSum     string // hash recorded in the executable. "" if unknown (eg. -mod=vendor builds).
+	Status         DepStatus
+}
+
+// DepReport is the result of VerifyDeps. It is returned as the Cause of an
+// ErrDepMismatch error and can be extracted with errors.As.
+type DepReport struct {
+	Module string
+	Deps   []Dep // in the order passed to VerifyDeps
+}
+
+// OK reports whether every dependency matches.
+func (r *DepReport) OK() bool {
+	for _, d := range r.Deps {
+		if d.Status != DepMatch {
+			return false
 		}
 	}
-	return version
+	return true
 }
 
-// CheckDeps must only be called from within an init().
-func CheckDeps(moduleName string, imports ...string) {
-	onceDeps.Do(func() {
-		_deps, ok := debug.ReadBuildInfo()
-		if !ok {
-			panic("couldn't get fetch build info")
+func (r *DepReport) Error() string {
+	bad := []string{}
+	for _, d := range r.Deps {
+		if d.Status != DepMatch {
+			bad = append(bad, fmt.Sprintf("%s (%s: required %s, current %s)", d.Path, d.Status, d.required(), d.current()))
 		}
+	}
+	return strings.Join(bad, ", ")
+}
 
-		// Dependencies baked into executable
-		deps = map[string]string{}
-		for _, mod := range _deps.Deps {
-			if mod.Replace != nil {
-				if _, exists := deps[mod.Replace.Path]; exists {
-					panic(mod.Replace.Path + " already exists")
-				}
-				deps[mod.Replace.Path] = mod.Replace.Version
-			} else {
-				if _, exists := deps[mod.Path]; exists {
-					panic(mod.Path + " already exists")
-				}
-				deps[mod.Path] = mod.Version
-			}
+// required describes the required version for display.
+// The hash is only shown when it is what differs.
+func (d Dep) required() string {
+	if d.Status == DepSumMismatch {
+		return d.Required + " " + d.Sum
+	}
+	return d.Required
+}
+
+// current describes what the executable contains for display.
+func (d Dep) current() string {
+	current := d.Current
+	if d.Status == DepSumMismatch {
+		current += " " + d.CurrentSum
+	}
+	if d.CurrentReplace != "" && d.CurrentReplace != d.Path {
+		return strings.TrimSpace(d.CurrentReplace + " " + current)
+	}
+	return current
+}
+
+// GoMod returns require and replace directives that pin every dependency of the module.
+func (r *DepReport) GoMod() string {
+	return goMod(r.Module, r.Deps)
+}
+
+// goMod returns require and replace directives that pin deps. module names who requires them.
+func goMod(module string, deps []Dep) string {
+	f := &modfile.File{}
+	f.AddModuleStmt(module)
+	replaceStmts := []string{}
+	for _, d := range deps {
+		f.AddRequire(d.Path, d.Version)
+		if d.Replace != "" {
+			replaceStmts = append(replaceStmts, fmt.Sprintf(`%s => %s %s`, d.Path, d.Replace, d.Required))
+		} else {
+			replaceStmts = append(replaceStmts, fmt.Sprintf(`%s => %s %s`, d.Path, d.Path, d.Version))
 		}
-	})
-
-	defer func() {
-		if r := recover(); r != nil {
-			table := tablewriter.NewWriter(os.Stderr)
-			table.SetAutoWrapText(false)
-			table.SetHeader([]string{"Dep (" + moduleName + ")", "Required", "Current", "*"})
-
-			for _, i := range imports {
-				splits := strings.SplitN(i, "=>", 2)
-				splits = strings.SplitN(splits[len(splits)-1], "::", 2)
-				ip := splits[0]
-				_v := splits[1]
-				_current := deps[ip]
-				final := ""
-
-				v, current := extractVersion(_v), extractVersion(_current)
-				if v != current {
-					final = "<=="
-				}
-				table.Append([]string{ip, _v, _current, final})
-			}
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "Dependency version mismatch: Exact Versions are required.")
-			fmt.Fprintln(os.Stderr, "The replace directive can be used to pin dependencies to a single commit (rather than a minimum version).")
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "(This is a limitation also inherent in the plugin pkg: https://pkg.go.dev/plugin#hdr-Warnings)")
-			fmt.Fprintln(os.Stderr, "⮑ “Similar crashing problems are likely to arise unless all common dependencies of the application and its plugins are built from exactly the same source code.”")
-			fmt.Fprintln(os.Stderr, "")
-
-			table.Render()
-
-			// Generate go mod lines
-			f := &modfile.File{}
-			f.AddModuleStmt(moduleName)
-			replaceStmts := []string{}
-			for _, i := range imports {
-				splits := strings.SplitN(i, "=>", 2)
-				require := splits[0]
-				requireSplits := strings.SplitN(require, "::", 2)
-				ip := requireSplits[0]
-				ver := requireSplits[1]
-				f.AddRequire(ip, ver)
-				if len(splits) > 1 {
-					replace := splits[1]
-					replaceSplits := strings.SplitN(replace, "::", 2)
-					replaceStmts = append(replaceStmts, fmt.Sprintf(`%s => %s %s`, ip, replaceSplits[0], replaceSplits[1]))
-				} else {
-					replaceStmts = append(replaceStmts, fmt.Sprintf(`%s => %s %s`, ip, ip, ver))
-				}
-			}
-			modText, _ := f.Format()
+	}
+	modText, _ := f.Format()
 
-			if pos := bytes.Index(modText, []byte("require")); pos != -1 {
-				modText = modText[pos:]
-			}
+	if pos := bytes.Index(modText, []byte("require")); pos != -1 {
+		modText = modText[pos:]
+	}
 
-			if len(replaceStmts) > 0 {
-				buf := bytes.NewBuffer(modText)
-				buf.WriteString("\n// Pinned dependencies for " + moduleName + ":\nreplace (\n")
-				for _, r := range replaceStmts {
-					buf.WriteString("	" + r + "\n")
-				}
-				buf.WriteString(")")
-				modText = buf.Bytes()
-			}
+	if len(replaceStmts) > 0 {
+		buf := bytes.NewBuffer(modText)
+		buf.WriteString("\n// Pinned dependencies for " + module + ":\nreplace (\n")
+		for _, r := range replaceStmts {
+			buf.WriteString("	" + r + "\n")
+		}
+		buf.WriteString(")")
+		modText = buf.Bytes()
+	}
+	return string(modText)
+}
+
+// Fprint writes the report as a table followed by a sample go.mod.
+func (r *DepReport) Fprint(w io.Writer) {
+	fprintDepHeader(w)
+	r.fprintTable(w)
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "sample go.mod:")
+	fmt.Fprintln(w, r.GoMod())
+}
+
+func (r *DepReport) fprintTable(w io.Writer) {
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Dep (" + r.Module + ")", "Required", "Current", "*"})
+	for _, d := range r.Deps {
+		final := ""
+		if d.Status != DepMatch {
+			final = "<== " + d.Status.String()
+		}
+		table.Append([]string{d.Path, d.required(), d.current(), final})
+	}
+	table.Render()
+}
 
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "sample go.mod:")
-			fmt.Fprintln(os.Stderr, string(modText))
-			os.Exit(1)
+// fprintDepHeader explains why exact versions are required.
+func fprintDepHeader(w io.Writer) {
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Dependency version mismatch: Exact Versions are required.")
+	fmt.Fprintln(w, "The replace directive can be used to pin dependencies to a single commit (rather than a minimum version).")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "(This is a limitation also inherent in the plugin pkg: https://pkg.go.dev/plugin#hdr-Warnings)")
+	fmt.Fprintln(w, "⮑ “Similar crashing problems are likely to arise unless all common dependencies of the application and its plugins are built from exactly the same source code.”")
+	fmt.Fprintln(w, "")
+}
+
+// ParseDep parses a dependency as declared to CheckDeps: path::version or
+// path::version=>replacement::version, optionally followed by the go.sum hash of the
+// module built against (eg. path::version::h1:...). The fields describing the executable are left empty.
+func ParseDep(s string) (Dep, error) {
+	spec, err := depspec.Parse(s)
+	if err != nil {
+		return Dep{}, err
+	}
+	return Dep{Path: spec.Path, Version: spec.Version, Replace: spec.Replace, Required: spec.Required, Sum: spec.Sum}, nil
+}
+
+// spec returns the dependency as declared to CheckDeps.
+func (d Dep) spec() depspec.Spec {
+	return depspec.Spec{Path: d.Path, Version: d.Version, Replace: d.Replace, Required: d.Required, Sum: d.Sum}
+}
+
+// VerifyDeps compares the dependencies a module requires with the modules baked into the
+// executable. Each import is of the form path::version, or path::version=>replacement::version
+// when the module was built against a replacement.
+//
+// An import may also declare the go.sum hash of the module it was built against
+// (eg. path::version::h1:...). It is compared with the hash recorded in the executable,
+// so a fork published under the same version is reported as DepSumMismatch.
+// Executables that record no hash (eg. built with -mod=vendor) are only checked by version.
+//
+// The report is always returned when the imports are valid. If any dependency does not
+// match, the error wraps ErrDepMismatch with the report as its Cause.
+func VerifyDeps(moduleName string, imports ...string) (*DepReport, error) {
+	return Default.VerifyDeps(moduleName, imports...)
+}
+
+// WithBuildInfo makes l verify dependencies against info instead of the executable's build info.
+func WithBuildInfo(info *debug.BuildInfo) Option {
+	return func(l *Linker) { l.buildInfo = info }
+}
+
+// builtDeps returns the modules of l's build info by path, or nil if it is unavailable.
+// depMu must be held.
+func (l *Linker) builtDeps() map[string]*debug.Module {
+	if l.deps == nil {
+		info := l.buildInfo
+		if info == nil {
+			info = buildInfo()
+		}
+		if info == nil {
+			return nil
+		}
+		l.deps = map[string]*debug.Module{}
+		for _, mod := range info.Deps {
+			l.deps[mod.Path] = mod
 		}
-	}()
+	}
+	return l.deps
+}
 
+// VerifyDeps is like the package-level VerifyDeps but compares with l's build info.
+func (l *Linker) VerifyDeps(moduleName string, imports ...string) (*DepReport, error) {
+	l.depMu.Lock()
+	deps := l.builtDeps()
+	l.depMu.Unlock()
+	if deps == nil {
+		return nil, &Error{Name: moduleName, Err: ErrDepMismatch, Cause: fmt.Errorf("couldn't get fetch build info")}
+	}
+
+	report := &DepReport{Module: moduleName}
 	for _, i := range imports {
-		var ip string // import path
-		var _v string // version (could be tag (ie. v1.0.0) or (psuedo) a1030444159b))
-
-		splits := strings.SplitN(i, "=>", 2)
-		if len(splits) > 1 {
-			// Replace found
-			splits := strings.SplitN(splits[1], "::", 2)
-			ip = splits[0]
-			_v = splits[1]
-		} else {
-			// No replacement OR artificial replacement we added in of itself
-			splits := strings.SplitN(splits[0], "::", 2)
-			ip = splits[0]
-			_v = splits[1]
+		d, err := ParseDep(i)
+		if err != nil {
+			return nil, &Error{Name: moduleName, Err: ErrInvalidDep, Cause: err}
 		}
 
-		_val, exists := deps[ip]
-		if !exists {
-			// huh? The required dependency is not in the build.
-			panic(ip)
+		// Compare against the replacement (if expected) or the module itself
+		wantPath := d.Path
+		if d.Replace != "" {
+			wantPath = d.Replace
 		}
 
-		if extractVersion(_v) != extractVersion(_val) {
-			panic(ip)
+		mod, exists := deps[d.Path]
+		switch {
+		case !exists:
+			// huh? The required dependency is not in the build.
+			d.Status = DepMissing
+		case mod.Replace != nil:
+			d.CurrentReplace, d.Current, d.CurrentSum = mod.Replace.Path, mod.Replace.Version, mod.Replace.Sum
+		default:
+			d.Current, d.CurrentSum = mod.Version, mod.Sum
+		}
+		if exists {
+			gotPath := d.Path
+			if d.CurrentReplace != "" {
+				gotPath = d.CurrentReplace
+			}
+			switch {
+			case gotPath != wantPath || d.Current == "":
+				d.Status = DepReplaced
+			case depspec.ExtractVersion(d.Required) != depspec.ExtractVersion(d.Current):
+				d.Status = DepMismatch
+			case d.Sum != "" && d.CurrentSum != "" && d.Sum != d.CurrentSum:
+				d.Status = DepSumMismatch
+			default:
+				d.Status = DepMatch
+			}
 		}
+		report.Deps = append(report.Deps, d)
 	}
 
-	return
+	if !report.OK() {
+		return report, &Error{Name: moduleName, Err: ErrDepMismatch, Cause: report}
+	}
+	return report, nil
 }
 
-func GoVersionCheck(moduleName string, goBuildVersion string) {
+// CheckDeps must only be called from within an init().
+// It records the dependencies the module requires. Every recorded module is verified
+// together before the first object file is linked (or by VerifyAll), so all
+// mismatches and conflicts between modules are reported at once. If any is found,
+// the link fails with an ErrDepMismatch error whose Cause is a *VerifyReport:
+// LoadE, Link and Module.Acquire return it and Load panics with it.
+// VerifyReport.Fprint prints the mismatches and a sample go.mod.
+// Use VerifyDeps to handle mismatches of a single module.
+func CheckDeps(moduleName string, imports ...string) {
+	Default.CheckDeps(moduleName, imports...)
+}
+
+// CheckDeps records the dependencies a module requires to be verified before l links.
+func (l *Linker) CheckDeps(moduleName string, imports ...string) {
+	report, err := l.VerifyDeps(moduleName, imports...)
+	if report == nil {
+		panic(err)
+	}
+	l.depMu.Lock()
+	defer l.depMu.Unlock()
+	l.requirements = append(l.requirements, report)
+}
+
+// VerifyGoVersion returns an ErrUnsupportedGoVersion error if the module's objects were
+// built with a different Go version than the executable.
+func VerifyGoVersion(moduleName string, goBuildVersion string) error {
 	if rv := runtime.Version(); rv != goBuildVersion {
-		fmt.Fprintf(os.Stderr, `module %s: was built using %s but application was built using: %s. Consider changing build tag.`, moduleName, goBuildVersion, rv)
-		os.Exit(1)
+		return &Error{Name: moduleName, Err: ErrUnsupportedGoVersion, Cause: fmt.Errorf("built using %s but the executable was built using %s. Consider changing build tag", goBuildVersion, rv)}
+	}
+	return nil
+}
+
+// GoVersionCheck must only be called from within an init().
+// If VerifyGoVersion fails, the error is recorded and every later link fails with it.
+func GoVersionCheck(moduleName string, goBuildVersion string) {
+	Default.GoVersionCheck(moduleName, goBuildVersion)
+}
+
+// GoVersionCheck records a failure of VerifyGoVersion to fail every later link of l.
+func (l *Linker) GoVersionCheck(moduleName string, goBuildVersion string) {
+	if err := VerifyGoVersion(moduleName, goBuildVersion); err != nil {
+		l.depMu.Lock()
+		defer l.depMu.Unlock()
+		l.goVersionErrs = append(l.goVersionErrs, err)
 	}
 }
@@ -0,0 +1,72 @@
+package golinker_test
+
+import (
+	"errors"
+	"runtime/debug"
+	"testing"
+
+	"github.com/romance-dev/golinker"
+	"github.com/romance-dev/golinker/golinkertest"
+)
+
+// TestCheckDepsPerLinker records a mismatched dependency with one Linker.
+// Only that Linker must fail to link.
+func TestCheckDepsPerLinker(t *testing.T) {
+	obj := golinkertest.Compile(t, "golinkertest/testdata/vendorpkg")
+	info := &debug.BuildInfo{Deps: []*debug.Module{{Path: "example.com/dep", Version: "v1.0.0"}}}
+	mismatched := golinkertest.NewLinker(t, golinker.WithBuildInfo(info))
+	other := golinkertest.NewLinker(t, golinker.WithBuildInfo(info))
+	mismatched.CheckDeps("example.com/mod", "example.com/dep::v1.2.0")
+	other.CheckDeps("example.com/mod", "example.com/dep::v1.0.0")
+	for _, l := range []*golinker.Linker{mismatched, other} {
+		if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var report *golinker.VerifyReport
+	if err := mismatched.Link(); !errors.Is(err, golinker.ErrDepMismatch) || !errors.As(err, &report) {
+		t.Fatalf("got %v, want ErrDepMismatch", err)
+	}
+	if err := other.Link(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mismatch is reported once, then the pending object files are linked
+	if err := mismatched.VerifyAll(); !errors.Is(err, golinker.ErrDepMismatch) {
+		t.Fatalf("VerifyAll: got %v, want ErrDepMismatch", err)
+	}
+	if err := mismatched.Link(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDepSameSource(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"example.com/dep::v1.0.0", "example.com/dep::v1.0.0", true},
+		{"example.com/dep::v1.0.0", "example.com/dep::v1.1.0", false},
+		{"example.com/dep::v1.0.0=>example.com/fork::v1.0.0", "example.com/dep::v1.0.0", false},
+		{"example.com/dep::v0.0.0-20250303095825-24047e466509", "example.com/dep::v1.0.0-20250303095825-24047e466509", true},
+		{"example.com/dep::v1.0.0::h1:a=", "example.com/dep::v1.0.0", true},
+		{"example.com/dep::v1.0.0::h1:a=", "example.com/dep::v1.0.0::h1:b=", false},
+	}
+	for _, tt := range tests {
+		a, err := golinker.ParseDep(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := golinker.ParseDep(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.SameSource(b); got != tt.want {
+			t.Errorf("%s and %s: got %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := golinker.ParseDep("example.com/dep::v1.0.0::h1:a=>example.com/fork::v1.0.0"); err == nil {
+		t.Error("ParseDep accepted a hash before the replacement")
+	}
+}
@@ -9,9 +9,46 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Storage describes where an object file is kept until it has been linked.
+type Storage int
+
+const (
+	StoragePath   Storage = iota // existing object file passed to LoadObject
+	StorageMemory                // anonymous in-memory file (memfd_create on Linux)
+	StorageDisk                  // temporary file in os.TempDir or the executable's directory
 )
 
-func getTempDir() string {
+func (s Storage) String() string {
+	switch s {
+	case StoragePath:
+		return "path"
+	case StorageMemory:
+		return "memory"
+	case StorageDisk:
+		return "disk"
+	}
+	return "Storage(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ObjectStorage reports where the latest object file registered for a package was stored.
+func ObjectStorage(fullPackageName string) (Storage, bool) {
+	return Default.ObjectStorage(fullPackageName)
+}
+
+// ObjectStorage reports where the latest object file registered with l for a package was stored.
+func (l *Linker) ObjectStorage(fullPackageName string) (Storage, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.objectStorage[fullPackageName]
+	return s, ok
+}
+
+func getTempDir() (string, error) {
 	tempDir := os.TempDir()
 
 	// Create a file to test if permissions allow storage
@@ -20,56 +57,143 @@ func getTempDir() string {
 	err := os.WriteFile(randFile, []byte{}, 0644)
 	if err == nil {
 		os.Remove(randFile)
-		return tempDir
+		return tempDir, nil
 	}
 
 	// os.TempDir failed so try directory of executable
 	exePath, err1 := os.Executable()
 	if err1 != nil {
-		panic(pkgname + ": os.WriteFile(" + tempDir + "): " + err.Error())
+		return "", &Error{Err: ErrWriteFailed, Cause: err}
 	}
 
 	tempDir = filepath.Dir(exePath)
 	randFile = filepath.Join(tempDir, randN)
 	err1 = os.WriteFile(randFile, []byte{}, 0644)
 	if err1 != nil {
-		panic(pkgname + ": os.WriteFile(" + tempDir + "): " + err1.Error())
+		return "", &Error{Err: ErrWriteFailed, Cause: err1}
 	}
 	os.Remove(randFile)
 
-	return tempDir
+	return tempDir, nil
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// SetMaxObjectSize limits the size of a decompressed object file (default: 1 GiB).
+// A limit of 0 or less disables the check.
+func SetMaxObjectSize(n int64) {
+	Default.SetMaxObjectSize(n)
+}
+
+// SetMaxObjectSize limits the size of a decompressed object file loaded by l.
+func (l *Linker) SetMaxObjectSize(n int64) {
+	l.maxObjectSize.Store(n)
+}
+
+// sizeLimitReader fails with ErrObjectTooLarge once more than n bytes have been read.
+type sizeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrObjectTooLarge
+	}
+	return n, err
+}
+
+// decompress returns a reader of the raw object file. gzip, zstd and xz are
+// detected from their magic bytes. Anything else is assumed to be a raw object file.
+// Reading more than max bytes fails unless max is 0 or less.
+func decompress(pkg []byte, max int64) (io.Reader, func(), error) {
+	var r io.Reader = bytes.NewReader(pkg)
+	closer := func() {}
+
+	switch {
+	case bytes.HasPrefix(pkg, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, closer = zr, func() { zr.Close() }
+	case bytes.HasPrefix(pkg, zstdMagic):
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		r, closer = zr, zr.Close
+	case bytes.HasPrefix(pkg, xzMagic):
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = xr
+	}
+
+	if max > 0 {
+		r = &sizeLimitReader{r: r, n: max}
+	}
+	return r, closer, nil
+}
+
+// writeObject stores the package's object file in memory if possible, otherwise on disk.
+// It returns the location to pass to the linker.
+func (l *Linker) writeObject(pkg []byte, fullPackageName string) (string, Storage, error) {
+	if dst, ok, err := l.writeBytesToMemory(pkg, fullPackageName, l.maxObjectSize.Load()); err != nil {
+		return "", 0, err
+	} else if ok {
+		l.addTemp(dst)
+		l.logger.Debug("object stored", "package", fullPackageName, "storage", StorageMemory)
+		return dst, StorageMemory, nil
+	}
+	dst, err := l.writeBytesToDisk(pkg, fullPackageName)
+	if err == nil {
+		l.logger.Debug("object stored", "package", fullPackageName, "storage", StorageDisk)
+	}
+	return dst, StorageDisk, err
 }
 
 // writeBytesToDisk writes the package's object file to disk and returns the location
-func writeBytesToDisk(pkg []byte, fullPackageName string) string {
+func (l *Linker) writeBytesToDisk(pkg []byte, fullPackageName string) (string, error) {
 	// Create a temp directory
-	tempDir := getTempDir()
+	tempDir := l.tempDir
+	if tempDir == "" {
+		var err error
+		if tempDir, err = getTempDir(); err != nil {
+			return "", err
+		}
+	}
 	dst := filepath.Join(tempDir, strings.ReplaceAll(fullPackageName, "/", "_")+"_"+strconv.Itoa(rand.Int())+".golinker")
 
-	// Assume gzipped
-	zr, err := gzip.NewReader(bytes.NewReader(pkg))
+	r, closer, err := decompress(pkg, l.maxObjectSize.Load())
 	if err != nil {
-		// Not a valid gzip file. Assume it's a raw object file.
-		err := os.WriteFile(dst, pkg, 0666)
-		if err != nil {
-			panic(pkgname + ": os.WriteFile(" + dst + "): " + err.Error())
-		}
-		toRemove = append(toRemove, dst)
-		return dst
+		return "", &Error{Name: fullPackageName, Err: ErrWriteFailed, Cause: err}
 	}
-	defer zr.Close()
+	defer closer()
 
 	f, err := os.Create(dst)
 	if err != nil {
-		panic(pkgname + ": os.Create(" + dst + "): " + err.Error())
+		return "", &Error{Name: fullPackageName, Err: ErrWriteFailed, Cause: err}
 	}
-	toRemove = append(toRemove, dst)
-	defer f.Close()
+	l.addTemp(dst)
 
-	// Write file to disk
-	_, err = io.Copy(f, zr)
+	// Write file to disk. A partial file is deleted straight away.
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		panic(pkgname + ": io.Copy(): " + err.Error())
+		l.mu.Lock()
+		l.removeTemp(dst)
+		l.mu.Unlock()
+		return "", &Error{Name: fullPackageName, Err: ErrWriteFailed, Cause: err}
 	}
-	return dst
+	return dst, nil
 }
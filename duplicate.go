@@ -0,0 +1,389 @@
+package golinker
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkujhd/goloader/obj"
+	"golang.org/x/mod/semver"
+)
+
+// DuplicatePolicy decides what happens when the same package is registered more than
+// once (including again after it was linked), or two object files define the same symbol.
+// When an object file is discarded in favour of one registered for the same package, the
+// package is provided by the kept one. A package discarded in favour of another package
+// fails to load with ErrDuplicate.
+//
+// Registering a package again after it was linked is a duplicate too. Under DuplicateFail
+// that link fails and loading the package again returns the error, while modules already
+// loaded stay in use. DuplicateKeepFirst ignores the late registration and
+// DuplicateKeepNewest links it into a new generation if its module version is not older.
+// Use Module.Reload to replace a loaded package regardless of the policy.
+type DuplicatePolicy int
+
+const (
+	DuplicateFail       DuplicatePolicy = iota // the link fails with ErrDuplicate
+	DuplicateKeepFirst                         // the first registration is linked
+	DuplicateKeepNewest                        // the registration from the newest module version is linked
+)
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateFail:
+		return "fail"
+	case DuplicateKeepFirst:
+		return "keep first"
+	case DuplicateKeepNewest:
+		return "keep newest"
+	}
+	return "DuplicatePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// WithDuplicatePolicy sets the DuplicatePolicy (see SetDuplicatePolicy).
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(l *Linker) { l.duplicatePolicy = p }
+}
+
+// SetDuplicatePolicy sets how duplicate registrations are resolved. The default is DuplicateFail.
+func SetDuplicatePolicy(p DuplicatePolicy) {
+	Default.SetDuplicatePolicy(p)
+}
+
+// SetDuplicatePolicy sets how duplicate registrations with l are resolved.
+func (l *Linker) SetDuplicatePolicy(p DuplicatePolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.duplicatePolicy = p
+}
+
+// Registration records where an object file was registered.
+type Registration struct {
+	Package string // fullPackageName passed to LoadObject
+	Caller  string // file:line of the call, usually in a stub's init
+	Module  string // module containing the caller
+	Version string // version of Module from the build info. "" if unknown.
+}
+
+func (r Registration) String() string {
+	s := r.Package + " (" + r.Caller
+	if r.Module != "" {
+		s += " in " + r.Module
+		if r.Version != "" {
+			s += "@" + r.Version
+		}
+	}
+	return s + ")"
+}
+
+// Duplicate is a package registered more than once, or symbols defined by more than one object file.
+type Duplicate struct {
+	Symbols       []string       // clashing symbols. nil for a duplicate package registration.
+	Registrations []Registration // in registration order
+	Kept          int            // index of the linked registration. -1 if the link failed.
+}
+
+// DuplicateReport lists the duplicates found when linking. It is returned as the Cause
+// of an ErrDuplicate error and can be extracted with errors.As.
+type DuplicateReport struct {
+	Duplicates []Duplicate
+}
+
+func (r *DuplicateReport) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d duplicates", len(r.Duplicates))
+	for _, d := range r.Duplicates {
+		if d.Symbols == nil {
+			fmt.Fprintf(&b, "\n  package %s registered by:", d.Registrations[0].Package)
+		} else {
+			syms := d.Symbols
+			if len(syms) > 3 {
+				syms = append(syms[:3:3], fmt.Sprintf("and %d more", len(d.Symbols)-3))
+			}
+			fmt.Fprintf(&b, "\n  %s defined by:", strings.Join(syms, ", "))
+		}
+		for i, reg := range d.Registrations {
+			kept := ""
+			if i == d.Kept {
+				kept = " (kept)"
+			}
+			fmt.Fprintf(&b, "\n    %s%s", reg, kept)
+		}
+	}
+	return b.String()
+}
+
+var ownPkgPath = reflect.TypeOf(Linker{}).PkgPath()
+
+// register returns the Registration of a call from outside of golinker.
+func register(fullPackageName string) Registration {
+	reg := Registration{Package: fullPackageName, Caller: "unknown"}
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if symbolPackage(frame.Function) != ownPkgPath {
+			reg.Caller = frame.File + ":" + strconv.Itoa(frame.Line)
+			reg.Module, reg.Version = callerModule(symbolPackage(frame.Function))
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	return reg
+}
+
+var buildInfo = sync.OnceValue(func() *debug.BuildInfo {
+	info, _ := debug.ReadBuildInfo()
+	return info
+})
+
+// callerModule returns the module providing pkg and its version.
+func callerModule(pkg string) (string, string) {
+	info := buildInfo()
+	if info == nil {
+		return "", ""
+	}
+	within := func(path string) bool {
+		return path != "" && (pkg == path || strings.HasPrefix(pkg, path+"/"))
+	}
+	path, version := "", ""
+	if within(info.Main.Path) {
+		path, version = info.Main.Path, info.Main.Version
+	}
+	for _, mod := range info.Deps {
+		if within(mod.Path) && len(mod.Path) > len(path) {
+			path, version = mod.Path, mod.Version
+			if mod.Replace != nil && mod.Replace.Version != "" {
+				version = mod.Replace.Version
+			}
+		}
+	}
+	if version == "(devel)" {
+		version = ""
+	}
+	return path, version
+}
+
+// resolveDuplicates applies the DuplicatePolicy to the pending object files, comparing them
+// with each other and with the packages linked by earlier generations. It returns the object
+// files to link, with their defined symbols, and the package names they provide.
+// Discarded object files are deleted. mu must be held.
+//
+// A pending package left without an object file is added to the linked generation of the
+// same package that was kept, or to a failed generation of its own.
+func (l *Linker) resolveDuplicates(pending []toLoadObj) ([]toLoadObj, []string, error) {
+	// Linked packages come first as they were registered earlier
+	objs := append(l.linkedObjects(), pending...)
+
+	pkgNames := []string{} // pending packages
+	byPkg := map[string][]int{}
+	for i, o := range objs {
+		if o.linked == nil && !contains(pkgNames, o.pkgName) {
+			pkgNames = append(pkgNames, o.pkgName)
+		}
+		byPkg[o.pkgName] = append(byPkg[o.pkgName], i)
+	}
+
+	report := &DuplicateReport{}
+	dropped := map[int]bool{}
+	keptBy := map[int]int{}    // dropped index => kept index
+	droppedIn := map[int]int{} // dropped index => index in report.Duplicates
+	resolve := func(symbols []string, indexes []int) {
+		d := Duplicate{Symbols: symbols, Kept: -1}
+		for _, i := range indexes {
+			d.Registrations = append(d.Registrations, objs[i].reg)
+		}
+		if l.duplicatePolicy != DuplicateFail {
+			d.Kept = l.keep(d.Registrations)
+			for n, i := range indexes {
+				if n != d.Kept {
+					dropped[i] = true
+					keptBy[i] = indexes[d.Kept]
+					droppedIn[i] = len(report.Duplicates)
+				}
+			}
+			l.queueLog(slog.LevelWarn, "duplicate", slog.String("kept", d.Registrations[d.Kept].String()), slog.String("policy", l.duplicatePolicy.String()))
+		}
+		report.Duplicates = append(report.Duplicates, d)
+	}
+
+	for _, p := range pkgNames {
+		if len(byPkg[p]) > 1 {
+			resolve(nil, byPkg[p])
+		}
+	}
+
+	// Symbols defined by more than one of the remaining object files. The symbols of
+	// pending object files are always read, as they are needed by later links.
+	candidates := []int{}
+	for _, p := range pkgNames {
+		for _, i := range byPkg[p] {
+			if !dropped[i] {
+				candidates = append(candidates, i)
+				break
+			}
+		}
+	}
+	for i, o := range objs {
+		if o.linked != nil && len(byPkg[o.pkgName]) == 1 {
+			candidates = append(candidates, i)
+		}
+	}
+	definedBy := map[string][]int{}
+	for _, i := range candidates {
+		if objs[i].linked == nil {
+			syms, err := definedSymbols(objs[i].objpath, objs[i].pkgName)
+			if err != nil {
+				return nil, pkgNames, &Error{Name: objs[i].pkgName, Err: ErrLinkFailed, Cause: err}
+			}
+			objs[i].symbols = syms
+		}
+		for _, s := range objs[i].symbols {
+			definedBy[s] = append(definedBy[s], i)
+		}
+	}
+	clashes := map[string][]string{} // indexes => symbols
+	for s, indexes := range definedBy {
+		sort.Ints(indexes)
+		if len(indexes) > 1 && objs[indexes[len(indexes)-1]].linked == nil {
+			key := fmt.Sprint(indexes)
+			clashes[key] = append(clashes[key], s)
+		}
+	}
+	keys := make([]string, 0, len(clashes))
+	for k := range clashes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		syms := clashes[k]
+		sort.Strings(syms)
+		indexes := []int{}
+		for _, i := range definedBy[syms[0]] {
+			if !dropped[i] {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) > 1 {
+			resolve(syms, indexes)
+		}
+	}
+
+	if len(report.Duplicates) > 0 && l.duplicatePolicy == DuplicateFail {
+		return nil, pkgNames, &Error{Err: ErrDuplicate, Cause: report}
+	}
+	kept := []toLoadObj{}
+	for i, o := range objs {
+		switch {
+		case o.linked != nil:
+		case dropped[i]:
+			l.removeTemp(o.objpath)
+		default:
+			kept = append(kept, o)
+		}
+	}
+	provided := []string{}
+	for _, p := range pkgNames {
+		var linked *generation // kept generation of p
+		lost := &DuplicateReport{}
+		reported := map[int]bool{}
+		for _, i := range byPkg[p] {
+			if objs[i].linked != nil {
+				continue
+			}
+			if !dropped[i] {
+				lost = nil // p is linked by this link
+				break
+			}
+			if k := objs[keptBy[i]]; k.pkgName == p && k.linked != nil {
+				linked = k.linked
+			}
+			if n := droppedIn[i]; !reported[n] {
+				reported[n] = true
+				lost.Duplicates = append(lost.Duplicates, report.Duplicates[n])
+			}
+		}
+		switch {
+		case lost == nil:
+			provided = append(provided, p)
+		case linked != nil:
+			if !contains(linked.pkgNames, p) {
+				linked.pkgNames = append(linked.pkgNames, p)
+			}
+		default:
+			l.generations = append(l.generations, &generation{pkgNames: []string{p}, err: &Error{Name: p, Err: ErrDuplicate, Cause: lost}})
+		}
+	}
+	return kept, provided, nil
+}
+
+// linkedObjects describes the object file providing each package linked by an earlier
+// generation, so that pending object files can be compared with them. mu must be held.
+func (l *Linker) linkedObjects() []toLoadObj {
+	newest := map[string]int{}
+	objs := []toLoadObj{}
+	for _, gen := range l.generations {
+		if gen.err != nil {
+			continue
+		}
+		for _, p := range gen.pkgNames {
+			reg, ok := gen.regs[p]
+			if !ok {
+				reg = Registration{Package: p, Caller: "unknown"} // linked by Module.Reload
+			}
+			o := toLoadObj{pkgName: p, reg: reg, symbols: gen.symbols[p], linked: gen}
+			if i, ok := newest[p]; ok {
+				objs[i] = o
+			} else {
+				newest[p] = len(objs)
+				objs = append(objs, o)
+			}
+		}
+	}
+	return objs
+}
+
+// keep returns the index of the registration to link under a keep policy.
+// DuplicateKeepNewest compares module versions and falls back to the latest registration.
+func (l *Linker) keep(regs []Registration) int {
+	if l.duplicatePolicy == DuplicateKeepFirst {
+		return 0
+	}
+	newest := 0
+	for i := 1; i < len(regs); i++ {
+		a, b := regs[newest].Version, regs[i].Version
+		if !semver.IsValid(a) || !semver.IsValid(b) || semver.Compare(b, a) >= 0 {
+			newest = i
+		}
+	}
+	return newest
+}
+
+// definedSymbols returns the symbols defined by an object file that must be unique.
+func definedSymbols(objpath string, fullPackageName string) ([]string, error) {
+	pkg := obj.Pkg{
+		Syms:       map[string]*obj.ObjSymbol{},
+		CgoImports: map[string]*obj.CgoImport{},
+		File:       objpath,
+		PkgPath:    fullPackageName,
+	}
+	if err := pkg.Symbols(); err != nil {
+		return nil, err
+	}
+	pkg.AddSymIndex(map[string]int{})
+	names := []string{}
+	for _, sym := range pkg.Syms {
+		if !sym.DupOK {
+			names = append(names, obj.ReplacePkgPath(sym.Name, fullPackageName))
+		}
+	}
+	return names, nil
+}
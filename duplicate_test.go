@@ -0,0 +1,91 @@
+package golinker_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/romance-dev/golinker"
+	"github.com/romance-dev/golinker/golinkertest"
+)
+
+// TestDuplicateOfOtherPackage registers a linked object file again under another package.
+// That package loses every symbol to the linked one and must fail to load.
+func TestDuplicateOfOtherPackage(t *testing.T) {
+	obj := golinkertest.Compile(t, "golinkertest/testdata/vendorpkg")
+	l := golinkertest.NewLinker(t, golinker.WithDuplicatePolicy(golinker.DuplicateKeepFirst))
+	if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Link(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.LoadObjectE("example.com/alias", obj.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Link(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := l.LoadE("example.com/alias", "%s")()
+	var report *golinker.DuplicateReport
+	if !errors.Is(err, golinker.ErrDuplicate) || !errors.As(err, &report) {
+		t.Fatalf("got %v, want ErrDuplicate", err)
+	}
+	if d := report.Duplicates[0]; d.Symbols == nil || d.Registrations[d.Kept].Package != obj.Package {
+		t.Errorf("got %+v, want %s kept", d, obj.Package)
+	}
+	if _, err := l.LoadE(obj.Package, "%s")(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestReregisterLinked registers a package again after it was linked.
+func TestReregisterLinked(t *testing.T) {
+	obj := golinkertest.Compile(t, "golinkertest/testdata/vendorpkg")
+	for _, policy := range []golinker.DuplicatePolicy{golinker.DuplicateFail, golinker.DuplicateKeepFirst, golinker.DuplicateKeepNewest} {
+		t.Run(policy.String(), func(t *testing.T) {
+			l := golinkertest.NewLinker(t, golinker.WithDuplicatePolicy(policy))
+			if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+				t.Fatal(err)
+			}
+			first, err := l.LoadE(obj.Package, "%s")()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer first.Unload()
+
+			if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+				t.Fatal(err)
+			}
+			err = l.Link()
+			if policy == golinker.DuplicateFail {
+				if !errors.Is(err, golinker.ErrDuplicate) {
+					t.Fatalf("Link: got %v, want ErrDuplicate", err)
+				}
+				if _, err := l.LoadE(obj.Package, "%s")(); !errors.Is(err, golinker.ErrDuplicate) {
+					t.Errorf("LoadE: got %v, want ErrDuplicate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			current := first
+			if policy == golinker.DuplicateKeepNewest {
+				// The late registration is linked into a new generation
+				current, err = l.LoadE(obj.Package, "%s")()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer current.Unload()
+			}
+			add, err := golinker.Func[func(int, int) int](l, current, obj.Package+".Add")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := add(1, 2); got != 3 {
+				t.Errorf("Add(1, 2) = %d, want 3", got)
+			}
+		})
+	}
+}
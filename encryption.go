@@ -0,0 +1,138 @@
+package golinker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EncryptedObject is an AES-GCM encrypted object file. It can be passed to
+// LoadObject in place of []byte, or as the values of a map[string]EncryptedObject
+// keyed by Variant. It is decrypted in memory using the KeyProvider.
+type EncryptedObject struct {
+	KeyID string // passed to the KeyProvider
+	Data  []byte // nonce followed by the ciphertext (which includes the tag)
+}
+
+// KeyProvider supplies the AES key (16, 24 or 32 bytes) for an EncryptedObject.
+type KeyProvider interface {
+	Key(keyID string) ([]byte, error)
+}
+
+// KeyProviderFunc adapts a function to a KeyProvider.
+type KeyProviderFunc func(keyID string) ([]byte, error)
+
+func (f KeyProviderFunc) Key(keyID string) ([]byte, error) {
+	return f(keyID)
+}
+
+// EnvKeyProvider reads hex or base64 encoded keys from environment variables
+// named Prefix followed by the upper-cased key id (eg. GOLINKER_KEY_VENDOR).
+// Characters other than letters and digits in the key id are replaced by '_'.
+type EnvKeyProvider struct {
+	Prefix string // defaults to "GOLINKER_KEY_"
+}
+
+func (p EnvKeyProvider) Key(keyID string) ([]byte, error) {
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = "GOLINKER_KEY_"
+	}
+	name := prefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, keyID)
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", name)
+	}
+	return decodeKey([]byte(v))
+}
+
+// KeyFileProvider reads keys from the file <Dir>/<key id>.key.
+// The file holds the key encoded as hex, base64 or raw bytes.
+type KeyFileProvider struct {
+	Dir string
+}
+
+func (p KeyFileProvider) Key(keyID string) ([]byte, error) {
+	if keyID != filepath.Base(keyID) {
+		return nil, fmt.Errorf("invalid key id: %q", keyID)
+	}
+	b, err := os.ReadFile(filepath.Join(p.Dir, keyID+".key"))
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(b)
+}
+
+// SetKeyProvider sets the KeyProvider used to decrypt EncryptedObjects.
+// The default is EnvKeyProvider{}.
+func SetKeyProvider(kp KeyProvider) {
+	Default.SetKeyProvider(kp)
+}
+
+// SetKeyProvider sets the KeyProvider used by l to decrypt EncryptedObjects.
+func (l *Linker) SetKeyProvider(kp KeyProvider) {
+	l.keyMu.Lock()
+	defer l.keyMu.Unlock()
+	l.keyProvider = kp
+}
+
+// decodeKey decodes a hex, base64 or raw AES key.
+func decodeKey(b []byte) ([]byte, error) {
+	validLen := func(n int) bool { return n == 16 || n == 24 || n == 32 }
+	s := string(bytes.TrimSpace(b))
+	if key, err := hex.DecodeString(s); err == nil && validLen(len(key)) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && validLen(len(key)) {
+		return key, nil
+	}
+	if validLen(len(b)) {
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid AES key")
+}
+
+// decrypt returns the plaintext object using l's KeyProvider.
+func (l *Linker) decrypt(fullPackageName string, e EncryptedObject) ([]byte, error) {
+	l.keyMu.RLock()
+	kp := l.keyProvider
+	l.keyMu.RUnlock()
+	if kp == nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: fmt.Errorf("no key provider")}
+	}
+	key, err := kp.Key(e.KeyID)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: err}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: err}
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: err}
+	}
+	if len(e.Data) < gcm.NonceSize() {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: fmt.Errorf("data too short")}
+	}
+	nonce, ciphertext := e.Data[:gcm.NonceSize()], e.Data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrDecryptFailed, Cause: err}
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,91 @@
+package golinker
+
+import "errors"
+
+var (
+	// ErrObjectNotFound is returned when the path given to LoadObject does not exist.
+	ErrObjectNotFound = errors.New("object file does not exist")
+
+	// ErrUnsupportedGoVersion is returned when no object Variant matches the running executable,
+	// or a module's objects were built with a different Go version (see GoVersionCheck).
+	ErrUnsupportedGoVersion = errors.New("unsupported go version")
+
+	// ErrUnsupportedObject is returned when LoadObject is given a value it does not understand.
+	ErrUnsupportedObject = errors.New("unsupported object type")
+
+	// ErrUnsigned is returned when signatures are required and the object is not a SignedObject.
+	ErrUnsigned = errors.New("object is not signed")
+
+	// ErrSignatureInvalid is returned when a SignedObject is not signed by a trusted key.
+	ErrSignatureInvalid = errors.New("signature verification failed")
+
+	// ErrDecryptFailed is returned when an EncryptedObject could not be decrypted.
+	ErrDecryptFailed = errors.New("decryption failed")
+
+	// ErrObjectTooLarge is returned when a decompressed object exceeds the limit set by SetMaxObjectSize.
+	ErrObjectTooLarge = errors.New("object file too large")
+
+	// ErrReadFailed is returned when an object file or archive could not be read from its source.
+	ErrReadFailed = errors.New("could not read object file")
+
+	// ErrWriteFailed is returned when an object file could not be stored before linking.
+	ErrWriteFailed = errors.New("could not write object file")
+
+	// ErrLinkFailed is returned when the pending object files could not be linked.
+	ErrLinkFailed = errors.New("link error")
+
+	// ErrDuplicate is returned when a package is registered more than once, or two object files
+	// define the same symbol, and the DuplicatePolicy is DuplicateFail.
+	ErrDuplicate = errors.New("duplicate definition")
+
+	// ErrLoadFailed is returned when a linked package could not be loaded into memory.
+	ErrLoadFailed = errors.New("load error")
+
+	// ErrModuleInUse is returned when unloading a Module that still has references held.
+	ErrModuleInUse = errors.New("module in use")
+
+	// ErrModuleUnloaded is returned when acquiring a Module that has been unloaded.
+	ErrModuleUnloaded = errors.New("module unloaded")
+
+	// ErrReloadIncompatible is returned when a replacement object removes exported symbols.
+	ErrReloadIncompatible = errors.New("incompatible reload")
+
+	// ErrTypeMismatch is returned when a symbol's type in the object does not match the requested type.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrSymbolNotFound is returned when a symbol does not exist in a CodeModule.
+	ErrSymbolNotFound = errors.New("could not find symbol")
+
+	// ErrDepMismatch is returned when the executable's dependencies differ from those a module requires.
+	ErrDepMismatch = errors.New("dependency mismatch")
+
+	// ErrInvalidDep is returned when a dependency passed to VerifyDeps is not of the form path::version.
+	ErrInvalidDep = errors.New("invalid dependency")
+)
+
+// Error is the error type returned by the error-returning variants of the API.
+// Err is always one of the Err* values above so it can be tested with errors.Is.
+type Error struct {
+	Name  string // package or symbol the error relates to
+	Err   error  // sentinel error
+	Cause error  // underlying error (may be nil)
+}
+
+func (e *Error) Error() string {
+	s := pkgname + ": "
+	if e.Name != "" {
+		s += e.Name + ": "
+	}
+	s += e.Err.Error()
+	if e.Cause != nil {
+		s += ": " + e.Cause.Error()
+	}
+	return s
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
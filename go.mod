@@ -1,19 +1,21 @@
 module github.com/romance-dev/golinker
 
-go 1.18
+go 1.22
 
 require (
 	github.com/fatih/color v1.18.0
+	github.com/klauspost/compress v1.17.11
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/pkujhd/goloader v0.0.21-0.20250407074302-906f0cf5d398
+	github.com/ulikunitz/xz v0.5.12
 	golang.org/x/mod v0.20.0
+	golang.org/x/sys v0.25.0
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 )
 
 retract (
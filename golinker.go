@@ -1,13 +1,19 @@
 package golinker
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
+	"github.com/fatih/color"
 	"github.com/pkujhd/goloader"
 )
 
@@ -16,49 +22,152 @@ const pkgname = "golinker"
 type toLoadObj struct {
 	objpath string
 	pkgName string
+	reg     Registration
+	symbols []string    // symbols that must be unique. Read by resolveDuplicates.
+	linked  *generation // set if it describes a package linked by an earlier generation
 }
 
-type startupMessage struct {
-	message string
-	color   string
+// Linker owns a queue of object files, the symbols they are resolved against,
+// their temporary files and the modules loaded from them. Linkers are independent
+// of each other: an object registered with one can not resolve against a module
+// loaded by another. The package-level functions use Default.
+type Linker struct {
+	// mu guards the registry (pending objects, temporary files, startup messages)
+	// and the link state in linker.go, so registration is safe from any goroutine.
+	mu              sync.Mutex
+	toLoad          []toLoadObj                      // pending object files that need to be loaded
+	toRemove        []string                         // delete out these files after loading
+	objectStorage   map[string]Storage               // fullPackageName => where its latest object was stored
+	startupMessages []startupMessage                 // in registration order
+	suppressed      map[string]bool                  // module names ("all" suppresses every module)
+	generations     []*generation                    // in link order
+	loaded          []*CodeModule                    // modules loaded so far. Later generations resolve against them.
+	loadedFrom      map[*CodeModule]*goloader.Linker // loaded module => linker of its object files
+	memFiles        map[string]*os.File              // /proc path => anonymous file of an object kept in memory
+	duplicatePolicy DuplicatePolicy
+
+	// symMu guards symPtr. It is held for reading while linking and loading.
+	// When both are required, symMu is acquired before mu.
+	symMu  sync.RWMutex
+	symPtr map[string]uintptr
+
+	// depMu guards the requirements recorded by CheckDeps and GoVersionCheck.
+	depMu               sync.Mutex
+	buildInfo           *debug.BuildInfo         // nil uses the executable's
+	deps                map[string]*debug.Module // module path => module of buildInfo. Built on first use.
+	requirements        []*DepReport             // in CheckDeps call order
+	requirementsChecked int                      // len(requirements) when checkDeps last succeeded
+	goVersionErrs       []error
+
+	trustMu           sync.RWMutex
+	trustedKeys       map[string]ed25519.PublicKey // hex encoded key => key
+	revokedKeys       map[string]struct{}          // hex encoded key
+	requireSignatures bool
+
+	keyMu       sync.RWMutex
+	keyProvider KeyProvider
+
+	maxObjectSize atomic.Int64
+	tempDir       string // "" uses os.TempDir or the executable's directory
+
+	logHandler *swapHandler
+	logger     *slog.Logger
+
+	// logMu guards logQueue: events logged while other locks are held (see queueLog).
+	logMu    sync.Mutex
+	logQueue []slog.Record
 }
 
-var startupMessages = map[string]startupMessage{} // modulename => message details
-var toLoad = []toLoadObj{}                        // pending object files that need to be loaded
-var toRemove = []string{}                         // delete out these files after loading
+// Option configures a Linker created by New.
+type Option func(*Linker)
 
-var symPtr = make(map[string]uintptr)
+// WithLogHandler sends startup messages and internal events to h (see SetLogHandler).
+func WithLogHandler(h slog.Handler) Option {
+	return func(l *Linker) { l.SetLogHandler(h) }
+}
+
+// WithKeyProvider sets the KeyProvider used to decrypt EncryptedObjects (see SetKeyProvider).
+func WithKeyProvider(kp KeyProvider) Option {
+	return func(l *Linker) { l.keyProvider = kp }
+}
+
+// WithMaxObjectSize limits the size of a decompressed object file (see SetMaxObjectSize).
+func WithMaxObjectSize(n int64) Option {
+	return func(l *Linker) { l.maxObjectSize.Store(n) }
+}
+
+// WithTempDir stores object files that can not be kept in memory in dir.
+func WithTempDir(dir string) Option {
+	return func(l *Linker) { l.tempDir = dir }
+}
+
+// Default is the Linker used by the package-level functions.
+var Default *Linker
 
 func init() {
-	err := goloader.RegSymbol(symPtr)
+	l, err := New()
 	if err != nil {
-		panic(pkgname + ": goloader.RegSymbol: " + err.Error())
+		panic(err.Error())
 	}
+	Default = l
 }
 
-func cleanup() {
-	for _, p := range toRemove {
-		os.Remove(p)
+// New returns a Linker with its own copy of the host's symbols.
+// Reading them from the executable is expensive, so Linkers are best reused.
+func New(opts ...Option) (*Linker, error) {
+	l := &Linker{
+		toLoad:          []toLoadObj{},
+		toRemove:        []string{},
+		objectStorage:   map[string]Storage{},
+		startupMessages: []startupMessage{},
+		suppressed:      map[string]bool{},
+		loadedFrom:      map[*CodeModule]*goloader.Linker{},
+		memFiles:        map[string]*os.File{},
+		symPtr:          make(map[string]uintptr),
+		trustedKeys:     map[string]ed25519.PublicKey{},
+		revokedKeys:     map[string]struct{}{},
+		keyProvider:     EnvKeyProvider{},
+		logHandler:      newSwapHandler(NewTerminalHandler(color.Output, slog.LevelInfo)),
+	}
+	l.logger = slog.New(l.logHandler)
+	l.maxObjectSize.Store(1 << 30)
+	for _, opt := range opts {
+		opt(l)
 	}
-	toRemove = []string{}
+	if err := goloader.RegSymbol(l.symPtr); err != nil {
+		return nil, fmt.Errorf("%s: goloader.RegSymbol: %w", pkgname, err)
+	}
+	return l, nil
 }
 
-// LoadMessage schedules a startup message to be displayed when a module gets initialized.
-func LoadMessage(moduleName, message string) {
-	if message == "" {
-		return
+// Close discards the object files that have not been linked yet and deletes
+// their temporary files. Loaded modules are not affected.
+func (l *Linker) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.toRemove {
+		l.removeFile(p)
 	}
-	if pos := strings.Index(message, "::"); pos == -1 {
-		// pos not found
-		startupMessages[moduleName] = startupMessage{
-			message: message,
-			color:   "black",
-		}
-	} else {
-		// pos found
-		startupMessages[moduleName] = startupMessage{
-			message: message[pos+2:],
-			color:   message[0:pos],
+	l.toRemove = []string{}
+	l.toLoad = []toLoadObj{}
+	return nil
+}
+
+// addTemp records a temporary file to be deleted once it has been linked.
+func (l *Linker) addTemp(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.toRemove = append(l.toRemove, path)
+}
+
+// removeTemp deletes path now if it is a temporary file.
+// mu must be held.
+func (l *Linker) removeTemp(path string) {
+	for i, p := range l.toRemove {
+		if p == path {
+			l.removeFile(p)
+			l.toRemove = append(l.toRemove[:i], l.toRemove[i+1:]...)
+			return
 		}
 	}
 }
@@ -66,53 +175,152 @@ func LoadMessage(moduleName, message string) {
 // LoadObject loads an object file to be processed by the linker.
 // fullPackageName must include the module name at the start.
 // object can be a path to an existing object file or the raw data of an object file.
+// It can also be a SignedObject which is verified before use, or an
+// EncryptedObject which is decrypted in memory. io.Reader and ObjectSource
+// (eg. FSObject for an embed.FS) are read in full.
+//
+// Object files registered after the first link are linked into a new generation.
+// Registering a package that is already linked is resolved by the DuplicatePolicy.
 func LoadObject(fullPackageName string, object interface{}) {
+	Default.LoadObject(fullPackageName, object)
+}
+
+// LoadObjectE is like LoadObject but returns an error instead of panicking.
+func LoadObjectE(fullPackageName string, object interface{}) error {
+	return Default.LoadObjectE(fullPackageName, object)
+}
+
+// LoadObject loads an object file to be processed by l. See the package-level LoadObject.
+func (l *Linker) LoadObject(fullPackageName string, object interface{}) {
+	if err := l.LoadObjectE(fullPackageName, object); err != nil {
+		panic(err)
+	}
+}
+
+// LoadObjectE is like LoadObject but returns an error instead of panicking.
+func (l *Linker) LoadObjectE(fullPackageName string, object interface{}) error {
+	reg := register(fullPackageName)
+	objpath, storage, err := l.objectPath(fullPackageName, object)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.objectStorage[fullPackageName] = storage
+	l.toLoad = append(l.toLoad, toLoadObj{
+		objpath: objpath,
+		pkgName: fullPackageName,
+		reg:     reg,
+	})
+	return nil
+}
+
+// objectPath returns the location of the object file, writing it to memory or disk if required.
+func (l *Linker) objectPath(fullPackageName string, object interface{}) (string, Storage, error) {
+	if l.signaturesRequired() {
+		switch object.(type) {
+		case SignedObject, map[string]SignedObject:
+		default:
+			return "", 0, &Error{Name: fullPackageName, Err: ErrUnsigned}
+		}
+	}
+
 	switch pkg := object.(type) {
 	case string:
 		if _, err := os.Stat(pkg); errors.Is(err, os.ErrNotExist) {
-			panic(fmt.Sprintf("%s: object file: %s for: %s does not exist", pkgname, pkg, fullPackageName))
+			return "", 0, &Error{Name: fullPackageName, Err: ErrObjectNotFound, Cause: err}
 		}
-		toLoad = append(toLoad, toLoadObj{
-			objpath: pkg,
-			pkgName: fullPackageName,
-		})
+		return pkg, StoragePath, nil
 	case []byte:
-		toLoad = append(toLoad, toLoadObj{
-			objpath: writeBytesToDisk(pkg, fullPackageName),
-			pkgName: fullPackageName,
-		})
+		return l.writeObject(pkg, fullPackageName)
 	case map[string][]byte:
-		p, exists := pkg[strings.TrimPrefix(runtime.Version(), "go")]
-		if !exists {
-			panic(fmt.Sprintf("%s: %s is unavailable for %s", pkgname, fullPackageName, runtime.Version()))
+		p, err := selectVariant(fullPackageName, pkg)
+		if err != nil {
+			return "", 0, err
+		}
+		return l.writeObject(p, fullPackageName)
+	case SignedObject:
+		if err := l.verify(fullPackageName, pkg); err != nil {
+			return "", 0, err
+		}
+		return l.writeObject(pkg.Data, fullPackageName)
+	case map[string]SignedObject:
+		p, err := selectVariant(fullPackageName, pkg)
+		if err != nil {
+			return "", 0, err
+		}
+		if err := l.verify(fullPackageName, p); err != nil {
+			return "", 0, err
+		}
+		return l.writeObject(p.Data, fullPackageName)
+	case EncryptedObject:
+		plaintext, err := l.decrypt(fullPackageName, pkg)
+		if err != nil {
+			return "", 0, err
 		}
-		toLoad = append(toLoad, toLoadObj{
-			objpath: writeBytesToDisk(p, fullPackageName),
-			pkgName: fullPackageName,
-		})
+		return l.writeObject(plaintext, fullPackageName)
+	case map[string]EncryptedObject:
+		p, err := selectVariant(fullPackageName, pkg)
+		if err != nil {
+			return "", 0, err
+		}
+		plaintext, err := l.decrypt(fullPackageName, p)
+		if err != nil {
+			return "", 0, err
+		}
+		return l.writeObject(plaintext, fullPackageName)
+	case ObjectSource, io.Reader:
+		b, err := readSource(fullPackageName, pkg)
+		if err != nil {
+			return "", 0, err
+		}
+		return l.writeObject(b, fullPackageName)
 	default:
-		_ = object.(string)
+		return "", 0, &Error{Name: fullPackageName, Err: ErrUnsupportedObject, Cause: fmt.Errorf("%T is not a path, []byte, io.Reader or ObjectSource", object)}
 	}
 }
 
 func RegTypes(typs ...interface{}) {
+	Default.RegTypes(typs...)
+}
+
+func RegSymbolWithPath(path string) {
+	Default.RegSymbolWithPath(path)
+}
+
+// RegTypes registers the types from the host with l.
+func (l *Linker) RegTypes(typs ...interface{}) {
 	if len(typs) > 0 {
-		goloader.RegTypes(symPtr, typs...)
+		l.symMu.Lock()
+		defer l.symMu.Unlock()
+		goloader.RegTypes(l.symPtr, typs...)
 	}
 }
 
-func RegSymbolWithPath(path string) {
-	goloader.RegSymbolWithPath(symPtr, path)
+// RegSymbolWithPath registers the symbols of the executable at path with l.
+func (l *Linker) RegSymbolWithPath(path string) {
+	l.symMu.Lock()
+	defer l.symMu.Unlock()
+	goloader.RegSymbolWithPath(l.symPtr, path)
 }
 
 // SymbolPtr returns the memory-address of a symbol.
 func SymbolPtr(fullSymbolName string, codeModule *CodeModule) unsafe.Pointer {
+	ptr, err := Lookup(fullSymbolName, codeModule)
+	if err != nil {
+		panic(err)
+	}
+	return ptr
+}
+
+// Lookup is like SymbolPtr but returns an error instead of panicking.
+func Lookup(fullSymbolName string, codeModule *CodeModule) (unsafe.Pointer, error) {
 	fnPtr := codeModule.Syms[fullSymbolName]
 	if fnPtr == 0 {
-		panic(pkgname + ": could not find symbol: " + fullSymbolName)
+		return nil, &Error{Name: fullSymbolName, Err: ErrSymbolNotFound}
 	}
 	funcPtrContainer := (uintptr)(unsafe.Pointer(&fnPtr))
-	return unsafe.Pointer(&funcPtrContainer)
+	return unsafe.Pointer(&funcPtrContainer), nil
 }
 
 // Run_main runs the main() function of a package.
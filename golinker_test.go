@@ -0,0 +1,83 @@
+package golinker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reentrantHandler calls back into its Linker while handling a record.
+type reentrantHandler struct {
+	l *Linker
+}
+
+func (h reentrantHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h reentrantHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h reentrantHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h reentrantHandler) Handle(_ context.Context, r slog.Record) error {
+	h.l.ObjectStorage("example.com/mod/pkg0")
+	h.l.LoadMessage("handler", "seen: "+r.Message)
+	return nil
+}
+
+func TestLinkerConcurrent(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pkg := fmt.Sprintf("example.com/mod/pkg%d", i)
+			for j := 0; j < 20; j++ {
+				if err := l.LoadObjectE(pkg, []byte(fmt.Sprintf("%s.F%d", pkg, j))); err != nil {
+					t.Error(err)
+					return
+				}
+				l.LoadMessage(pkg, fmt.Sprintf("green::%s %d", pkg, j))
+				l.RegTypes(i, j)
+				l.SuppressMessages(fmt.Sprintf("example.com/mod/pkg%d", (i+j)%workers))
+				if j%5 == 0 {
+					l.SetLogHandler(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
+				}
+				l.Link() // the objects are not real, only the locking is under test
+				l.ObjectStorage(pkg)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLogHandlerReentrant(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetLogHandler(reentrantHandler{l})
+	l.LoadMessage("example.com/mod", "hello")
+	if err := l.LoadObjectE("example.com/mod/pkg0", []byte("example.com/mod/pkg0.F")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Link()
+	}()
+	select {
+	case <-done:
+		l.Close()
+	case <-time.After(10 * time.Second):
+		t.Fatal("Link deadlocked on a log handler calling back into the Linker")
+	}
+}
@@ -0,0 +1,163 @@
+// Package golinkertest compiles packages from source into object files and loads them
+// with an isolated golinker.Linker. Code that depends on a golinker stub can then be
+// tested offline against the exact Go version running the test.
+//
+// The test binary must be built with -ldflags=-checklinkname=0 like any other
+// executable using golinker.
+//
+//	func TestAdd(t *testing.T) {
+//		l, codeModule := golinkertest.Load(t, "testdata/vendorpkg", "%s_ptr")
+//		add, err := golinker.Func[func(int, int) int](l, codeModule, "example.com/m/testdata/vendorpkg.Add")
+//		...
+//	}
+package golinkertest
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/romance-dev/golinker"
+)
+
+// Object is an object file compiled from source.
+type Object struct {
+	Package string // import path. It is the fullPackageName to register the object with.
+	Path    string // location of the object file
+}
+
+// Build compiles the package in dir into an object file within outDir.
+// It uses the toolchain that the go command in PATH selects for dir (as reported by
+// go env GOROOT) and fails if that is not the running Go version. buildFlags are passed to go build.
+func Build(dir string, outDir string, buildFlags ...string) (*Object, error) {
+	goEXEPath, err := goCommand(dir)
+	if err != nil {
+		return nil, err
+	}
+	goversion, err := run(dir, goEXEPath, "env", "GOVERSION")
+	if err != nil {
+		return nil, err
+	}
+	if want := strings.Fields(runtime.Version())[0]; goversion != want {
+		return nil, fmt.Errorf("golinkertest: %s is %s but the test runs %s", goEXEPath, goversion, want)
+	}
+
+	list, err := run(dir, goEXEPath, "list", "-f", "{{.ImportPath}} {{.Name}}", ".")
+	if err != nil {
+		return nil, err
+	}
+	importPath, name, _ := strings.Cut(list, " ")
+	if name == "main" {
+		return nil, fmt.Errorf("golinkertest: %s: can not compile package main into an object file", importPath)
+	}
+
+	obj := &Object{
+		Package: importPath,
+		Path:    filepath.Join(outDir, strings.ReplaceAll(importPath, "/", "_")+".a"),
+	}
+	args := append([]string{"build", "-buildmode=archive", "-o", obj.Path}, buildFlags...)
+	if _, err := run(dir, goEXEPath, append(args, ".")...); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Compile is like Build but stores the object file in t.TempDir and fails the test on error.
+func Compile(t testing.TB, dir string, buildFlags ...string) *Object {
+	t.Helper()
+	obj, err := Build(dir, t.TempDir(), buildFlags...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// NewLinker returns an isolated Linker that logs to t. It is closed when the test ends.
+func NewLinker(t testing.TB, opts ...golinker.Option) *golinker.Linker {
+	t.Helper()
+	opts = append([]golinker.Option{golinker.WithLogHandler(golinker.NewTerminalHandler(logWriter{t}, slog.LevelInfo))}, opts...)
+	l, err := golinker.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// Load compiles the package in dir, registers it with a new isolated Linker and loads it.
+// pattern and ptrs are the same as golinker.Load. It returns the Linker and the CodeModule,
+// which is unloaded when the test ends.
+func Load(t testing.TB, dir string, pattern string, ptrs ...golinker.Var) (*golinker.Linker, *golinker.CodeModule) {
+	t.Helper()
+	obj := Compile(t, dir)
+	l := NewLinker(t)
+	if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+		t.Fatal(err)
+	}
+	m := l.NewModule(obj.Package, pattern, ptrs...)
+	codeModule, err := m.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Release(codeModule)
+		if err := m.Unload(); err != nil {
+			t.Error(err)
+		}
+	})
+	return l, codeModule
+}
+
+// goCommand returns the go command of the toolchain that the go command in PATH selects for dir.
+func goCommand(dir string) (string, error) {
+	goEXEPath, err := exec.LookPath("go")
+	if err != nil {
+		return "", fmt.Errorf("golinkertest: %w", err)
+	}
+	root, err := run(dir, goEXEPath, "env", "GOROOT")
+	if err != nil {
+		return "", err
+	}
+	name := "go"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if p := filepath.Join(root, "bin", name); fileExists(p) {
+		return p, nil
+	}
+	return goEXEPath, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// run runs a command in dir and returns its trimmed stdout.
+func run(dir string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("golinkertest: %s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// logWriter writes each line to t.Log.
+type logWriter struct {
+	t testing.TB
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
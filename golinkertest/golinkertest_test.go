@@ -0,0 +1,19 @@
+package golinkertest_test
+
+import (
+	"testing"
+
+	"github.com/romance-dev/golinker"
+	"github.com/romance-dev/golinker/golinkertest"
+)
+
+func TestLoad(t *testing.T) {
+	l, codeModule := golinkertest.Load(t, "testdata/vendorpkg", "%s")
+	add, err := golinker.Func[func(int, int) int](l, codeModule, "github.com/romance-dev/golinker/golinkertest/testdata/vendorpkg.Add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := add(2, 3); got != 5 {
+		t.Errorf("Add(2, 3) = %d, want 5", got)
+	}
+}
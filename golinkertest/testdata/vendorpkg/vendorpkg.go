@@ -0,0 +1,7 @@
+// Package vendorpkg is compiled into an object file by the golinkertest tests.
+package vendorpkg
+
+// Add returns the sum of a and b.
+func Add(a, b int) int {
+	return a + b
+}
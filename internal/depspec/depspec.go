@@ -0,0 +1,90 @@
+// Package depspec parses the dependencies declared to golinker.CheckDeps. It is shared by
+// golinker and the golinker command, which can not import golinker itself.
+package depspec
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// Spec is a dependency of the form path::version or path::version=>replacement::version,
+// optionally followed by the go.sum hash of the module built against.
+type Spec struct {
+	Path     string // module path
+	Version  string // version required by the module
+	Replace  string // module path the dependency must be replaced with. "" if none.
+	Required string // exact version required (of Replace if set)
+	Sum      string // go.sum hash (h1:...) of the required module (of Replace if set). "" if not declared.
+}
+
+// Parse parses path::version[::h1:hash] or path::version=>replacement::version[::h1:hash].
+func Parse(s string) (Spec, error) {
+	require, replace, replaced := strings.Cut(s, "=>")
+	d := Spec{}
+	var ok bool
+	var sum string
+	if d.Path, d.Version, sum, ok = cutModule(require); !ok {
+		return Spec{}, fmt.Errorf("%q: expected path::version or path::version::h1:hash", s)
+	}
+	d.Required, d.Sum = d.Version, sum
+	if replaced {
+		if sum != "" {
+			return Spec{}, fmt.Errorf("%q: the hash must follow the replacement", s)
+		}
+		if d.Replace, d.Required, d.Sum, ok = cutModule(replace); !ok {
+			return Spec{}, fmt.Errorf("%q: expected path::version=>replacement::version", s)
+		}
+	}
+	return d, nil
+}
+
+// cutModule splits path::version[::h1:hash].
+func cutModule(s string) (path string, version string, sum string, ok bool) {
+	path, version, ok = strings.Cut(s, "::")
+	version, sum, _ = strings.Cut(version, "::")
+	if !ok || path == "" || version == "" {
+		return "", "", "", false
+	}
+	if sum != "" && !strings.HasPrefix(sum, "h1:") {
+		return "", "", "", false
+	}
+	return path, version, sum, true
+}
+
+// Built returns the module path the dependency is built from.
+func (d Spec) Built() string {
+	if d.Replace != "" {
+		return d.Replace
+	}
+	return d.Path
+}
+
+// SameSource reports whether a and b can be satisfied by the same module.
+func SameSource(a, b Spec) bool {
+	if a.Built() != b.Built() || ExtractVersion(a.Required) != ExtractVersion(b.Required) {
+		return false
+	}
+	return a.Sum == "" || b.Sum == "" || a.Sum == b.Sum
+}
+
+// ExtractVersion returns the version tag or commit hash
+func ExtractVersion(version string) string {
+	// Check version type
+	// 1. v1.2 (tag)
+	// 2. v6.0.0-20250303095825-24047e466509 (psuedo)
+	splits := strings.Split(version, "-")
+	if len(splits) == 3 && semver.IsValid(splits[0]) {
+		if _, err := time.Parse("20060102150405", splits[1]); err == nil {
+			// valid timestamp
+			if _, err := hex.DecodeString(splits[2]); err == nil {
+				// valid sha
+				return splits[2]
+			}
+		}
+	}
+	return version
+}
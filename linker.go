@@ -1,58 +1,224 @@
 package golinker
 
 import (
-	"sync"
+	"errors"
+	"log/slog"
 
-	"github.com/fatih/color"
 	"github.com/pkujhd/goloader"
+	"github.com/pkujhd/goloader/obj"
 )
 
-var onceLinker sync.Once
-var singletonLinker *goloader.Linker
-
-func linker() *goloader.Linker {
-	onceLinker.Do(func() {
-		defer cleanup()
-		fileLocs := []string{}
-		pkgNames := []string{}
-
-		for _, v := range toLoad {
-			fileLocs = append(fileLocs, v.objpath)
-			pkgNames = append(pkgNames, v.pkgName)
-		}
-		toLoad = []toLoadObj{}
-
-		var err error
-		singletonLinker, err = goloader.ReadObjs(fileLocs, pkgNames)
-		if err != nil {
-			panic(pkgname + ": Link error: " + err.Error())
-		}
-		deps = nil
-
-		// Print out startup messages
-		for _, m := range startupMessages {
-			switch m.color {
-			case "black":
-				color.Black(m.message)
-			case "red":
-				color.Red(m.message)
-			case "green":
-				color.Green(m.message)
-			case "yellow":
-				color.Yellow(m.message)
-			case "blue":
-				color.Blue(m.message)
-			case "magenta":
-				color.Magenta(m.message)
-			case "cyan":
-				color.Cyan(m.message)
-			case "white":
-				color.White(m.message)
-			default:
-				color.Black(m.color + "::" + m.message)
+// generation is one batch of object files linked together. The first generation
+// holds everything registered before the first Load. Objects registered
+// afterwards are linked into later generations on demand.
+type generation struct {
+	linker   *goloader.Linker
+	pkgNames []string
+	regs     map[string]Registration // package => registration of the linked object file
+	symbols  map[string][]string     // package => symbols that must be unique
+	err      error
+}
+
+// Link links every object file registered since the last link into a new generation.
+// It is called automatically by Load, so calling it is only required to surface
+// link errors early. It is a no-op if nothing is pending.
+func Link() error {
+	return Default.Link()
+}
+
+// Link links every object file registered with l since its last link into a new generation.
+func (l *Linker) Link() error {
+	defer l.flushLog()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.toLoad) == 0 {
+		return nil
+	}
+	if err := l.checkDeps(); err != nil {
+		return err // the object files stay pending
+	}
+	return l.link().err
+}
+
+// linker returns the linker of the generation that contains fullPackageName, linking
+// pending object files if required, together with the symbols it must be resolved against.
+// symMu must be held for reading while the symbols are in use.
+func (l *Linker) linker(fullPackageName string) (*goloader.Linker, map[string]uintptr, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	gen := l.findGeneration(fullPackageName)
+	if len(l.toLoad) > 0 && (gen == nil || l.isPending(fullPackageName)) {
+		if err := l.checkDeps(); err != nil {
+			return nil, nil, err
+		}
+		l.link()
+		gen = l.findGeneration(fullPackageName)
+	}
+	if gen == nil {
+		return nil, nil, &Error{Name: fullPackageName, Err: ErrLinkFailed, Cause: errors.New("no object file registered")}
+	}
+	if gen.err != nil {
+		return nil, nil, gen.err
+	}
+	return gen.linker, l.symbols(nil), nil
+}
+
+// isPending reports whether an object file for fullPackageName waits to be linked.
+// mu must be held.
+func (l *Linker) isPending(fullPackageName string) bool {
+	for _, v := range l.toLoad {
+		if v.pkgName == fullPackageName {
+			return true
+		}
+	}
+	return false
+}
+
+// findGeneration returns the newest generation containing fullPackageName.
+// mu must be held.
+func (l *Linker) findGeneration(fullPackageName string) *generation {
+	for i := len(l.generations) - 1; i >= 0; i-- {
+		for _, p := range l.generations[i].pkgNames {
+			if p == fullPackageName {
+				return l.generations[i]
 			}
 		}
-		startupMessages = nil
-	})
-	return singletonLinker
+	}
+	return nil
+}
+
+// symbols returns the host's symbols together with the symbols of every loaded module
+// other than exclude. mu and symMu must be held.
+func (l *Linker) symbols(exclude *CodeModule) map[string]uintptr {
+	if len(l.loaded) == 0 || len(l.loaded) == 1 && l.loaded[0] == exclude {
+		return l.symPtr
+	}
+	syms := make(map[string]uintptr, len(l.symPtr))
+	for _, cm := range l.loaded {
+		if cm == exclude {
+			continue
+		}
+		for k, v := range cm.Syms {
+			syms[k] = v
+		}
+	}
+	for k, v := range l.symPtr {
+		syms[k] = v // host takes precedence
+	}
+	return syms
+}
+
+// addLoaded records a loaded module so that later generations can resolve against it.
+func (l *Linker) addLoaded(codeModule *CodeModule, gl *goloader.Linker) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loaded = append(l.loaded, codeModule)
+	l.loadedFrom[codeModule] = gl
+}
+
+// objSymbol returns the symbol from the object file that codeModule was loaded from.
+// It returns nil if codeModule was not loaded by l.
+func (l *Linker) objSymbol(codeModule *CodeModule, name string) *obj.ObjSymbol {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if gl := l.loadedFrom[codeModule]; gl != nil {
+		return gl.ObjSymbolMap[name]
+	}
+	return nil
+}
+
+// removeLoaded forgets an unloaded module.
+func (l *Linker) removeLoaded(codeModule *CodeModule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.loadedFrom, codeModule)
+	for i, cm := range l.loaded {
+		if cm == codeModule {
+			l.loaded = append(l.loaded[:i], l.loaded[i+1:]...)
+			return
+		}
+	}
+}
+
+// relink links a replacement object file for fullPackageName on its own. It resolves
+// against the host and every loaded module except the one being replaced.
+// The generation is not visible to Load until it is passed to addGeneration.
+// symMu must be held for reading while the symbols are in use.
+func (l *Linker) relink(fullPackageName string, objpath string, replacing *CodeModule) (*generation, map[string]uintptr, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	gl, err := goloader.ReadObjs([]string{objpath}, []string{fullPackageName})
+	l.removeTemp(objpath)
+	if err != nil {
+		return nil, nil, &Error{Name: fullPackageName, Err: ErrLinkFailed, Cause: err}
+	}
+	return &generation{linker: gl, pkgNames: []string{fullPackageName}}, l.symbols(replacing), nil
+}
+
+// addGeneration makes a generation created by relink the newest source of its packages.
+// Pending object files for the same packages are discarded.
+func (l *Linker) addGeneration(gen *generation, storage Storage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generations = append(l.generations, gen)
+	for _, p := range gen.pkgNames {
+		l.objectStorage[p] = storage
+	}
+
+	pending := []toLoadObj{}
+	for _, v := range l.toLoad {
+		if l.findGeneration(v.pkgName) != gen {
+			pending = append(pending, v)
+		}
+	}
+	l.toLoad = pending
+}
+
+// link links the pending object files into a new generation.
+// mu must be held and the dependencies checked.
+func (l *Linker) link() *generation {
+	pending := l.toLoad
+	l.toLoad = []toLoadObj{}
+
+	objs, pkgNames, err := l.resolveDuplicates(pending)
+	gen := &generation{pkgNames: pkgNames, regs: map[string]Registration{}, symbols: map[string][]string{}}
+	l.generations = append(l.generations, gen)
+	if err != nil {
+		for _, v := range pending {
+			l.removeTemp(v.objpath)
+		}
+		gen.err = err
+		l.queueLog(slog.LevelDebug, "link failed", slog.Any("packages", pkgNames), slog.Any("err", err))
+		return gen
+	}
+
+	if len(objs) == 0 {
+		return gen // every object file was discarded in favour of a linked one
+	}
+
+	fileLocs := []string{}
+	objPkgNames := []string{}
+	for _, v := range objs {
+		fileLocs = append(fileLocs, v.objpath)
+		objPkgNames = append(objPkgNames, v.pkgName)
+		gen.regs[v.pkgName] = v.reg
+		gen.symbols[v.pkgName] = v.symbols
+	}
+
+	gen.linker, err = goloader.ReadObjs(fileLocs, objPkgNames)
+	for _, p := range fileLocs {
+		l.removeTemp(p)
+	}
+	if err != nil {
+		gen.err = &Error{Err: ErrLinkFailed, Cause: err}
+		l.queueLog(slog.LevelDebug, "link failed", slog.Any("packages", pkgNames), slog.Any("err", err))
+		return gen
+	}
+
+	l.queueLog(slog.LevelDebug, "link", slog.Any("packages", pkgNames))
+
+	l.printStartupMessages()
+	return gen
 }
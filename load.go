@@ -2,6 +2,7 @@ package golinker
 
 import (
 	"fmt"
+	"log/slog"
 	"reflect"
 	"sync"
 	"unsafe"
@@ -32,44 +33,94 @@ type Var struct {
 // Load returns a function that lazy-loads a CodeModule specific to a package.
 // It should be stored in a variable in the package. It will always return the same
 // CodeModule. The CodeModule must not be unloaded unless you know that you will
-// never use the package again. The CodeModule is derived from the Linker.
+// never use the package again (see Module for packages that need to be unloaded).
+// The CodeModule is derived from the Linker.
+//
+// Object files registered with LoadObject after the first Load are linked into
+// a new generation that resolves against the host and every module loaded so far.
 //
 // ptrs represents package-level variables which will be initialized to point
 // to the equivalent variable in the "backing-package".
 func Load(fullPackageName string, pattern string, ptrs ...Var) func() *CodeModule {
+	return Default.Load(fullPackageName, pattern, ptrs...)
+}
+
+// LoadE is like Load but the returned function reports failures as an error
+// instead of panicking. A failed load is not retried.
+func LoadE(fullPackageName string, pattern string, ptrs ...Var) func() (*CodeModule, error) {
+	return Default.LoadE(fullPackageName, pattern, ptrs...)
+}
+
+// Load returns a function that lazy-loads a CodeModule from l. See the package-level Load.
+func (l *Linker) Load(fullPackageName string, pattern string, ptrs ...Var) func() *CodeModule {
+	load := l.LoadE(fullPackageName, pattern, ptrs...)
+	return func() *CodeModule {
+		codeModule, err := load()
+		if err != nil {
+			panic(err)
+		}
+		return codeModule
+	}
+}
+
+// LoadE is like Load but the returned function reports failures as an error
+// instead of panicking. A failed load is not retried.
+func (l *Linker) LoadE(fullPackageName string, pattern string, ptrs ...Var) func() (*CodeModule, error) {
 	var (
 		once   sync.Once
-		valid  bool
-		p      interface{}
 		result *CodeModule
+		err    error
 	)
 	g := func() {
-		defer func() {
-			p = recover()
-			if !valid {
-				panic(p)
-			}
-		}()
-		result = func() *CodeModule {
-			codeModule, err := goloader.Load(linker(), symPtr)
-			if err != nil {
-				panic(fmt.Sprintf(`%s: %s: Load error: %s`, pkgname, fullPackageName, err.Error()))
-			}
-			for _, p := range ptrs {
-				name := fullPackageName + "." + fmt.Sprintf(pattern, p.Name)
-				q := (*(*func() unsafe.Pointer)(SymbolPtr(name, codeModule)))()
-				*(*unsafe.Pointer)(p.Ptr) = q
-			}
-			return codeModule
-		}()
-		valid = true
+		result, err = l.load(fullPackageName, pattern, ptrs)
 	}
 
-	return func() *CodeModule {
+	return func() (*CodeModule, error) {
 		once.Do(g)
-		if !valid {
-			panic(p)
+		return result, err
+	}
+}
+
+// load links (if required) and loads the package, then points ptrs at the
+// equivalent variables in the backing-package.
+func (l *Linker) load(fullPackageName string, pattern string, ptrs []Var) (*CodeModule, error) {
+	defer l.flushLog()
+	l.symMu.RLock()
+	defer l.symMu.RUnlock()
+	gl, syms, err := l.linker(fullPackageName)
+	if err != nil {
+		return nil, err
+	}
+	if report := l.unresolved(gl, syms); report != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrLoadFailed, Cause: report}
+	}
+	codeModule, err := goloader.Load(gl, syms)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrLoadFailed, Cause: err}
+	}
+	l.addLoaded(codeModule, gl)
+	l.queueLog(slog.LevelDebug, "load", slog.String("package", fullPackageName))
+	if err := pointVars(fullPackageName, pattern, ptrs, codeModule); err != nil {
+		l.unloadVersion(codeModule)
+		return nil, err
+	}
+	return codeModule, nil
+}
+
+// pointVars points ptrs at the equivalent variables in codeModule.
+// No Var is changed unless all of them are found.
+func pointVars(fullPackageName string, pattern string, ptrs []Var, codeModule *CodeModule) error {
+	qs := make([]unsafe.Pointer, len(ptrs))
+	for i, p := range ptrs {
+		name := fullPackageName + "." + fmt.Sprintf(pattern, p.Name)
+		ptr, err := Lookup(name, codeModule)
+		if err != nil {
+			return err
 		}
-		return result
+		qs[i] = (*(*func() unsafe.Pointer)(ptr))()
+	}
+	for i, p := range ptrs {
+		*(*unsafe.Pointer)(p.Ptr) = qs[i]
 	}
+	return nil
 }
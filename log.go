@@ -0,0 +1,175 @@
+package golinker
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Startup messages are logged at the Level of their Severity with the message as
+// the record's message and these attributes. golinker's own link and load events
+// are logged at slog.LevelDebug.
+const (
+	LogKeyModule   = "module"   // module that registered the startup message
+	LogKeyColor    = "color"    // color requested by LoadMessage
+	LogKeySeverity = "severity" // Severity of the startup message
+)
+
+// SetLogHandler sends startup messages and internal events to h.
+// A nil handler silences golinker. The default is a TerminalHandler
+// writing to stdout at slog.LevelInfo.
+func SetLogHandler(h slog.Handler) {
+	Default.SetLogHandler(h)
+}
+
+// SetLogHandler sends l's startup messages and internal events to h.
+func (l *Linker) SetLogHandler(h slog.Handler) {
+	if h == nil {
+		h = slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(1 << 10)})
+	}
+	l.logHandler.h.Store(&h)
+}
+
+// queueLog records an event to be sent to the log handler by flushLog. It is used
+// while mu or symMu is held, so that handlers may call back into l.
+func (l *Linker) queueLog(level slog.Level, msg string, attrs ...slog.Attr) {
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.AddAttrs(attrs...)
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	l.logQueue = append(l.logQueue, r)
+}
+
+// flushLog sends the queued events to the log handler.
+// Neither mu nor symMu may be held.
+func (l *Linker) flushLog() {
+	l.logMu.Lock()
+	queue := l.logQueue
+	l.logQueue = nil
+	l.logMu.Unlock()
+
+	ctx := context.Background()
+	for _, r := range queue {
+		if l.logHandler.Enabled(ctx, r.Level) {
+			l.logHandler.Handle(ctx, r)
+		}
+	}
+}
+
+// swapHandler forwards to a handler that can be replaced concurrently.
+type swapHandler struct {
+	h atomic.Pointer[slog.Handler]
+}
+
+func newSwapHandler(h slog.Handler) *swapHandler {
+	s := &swapHandler{}
+	s.h.Store(&h)
+	return s
+}
+
+func (s *swapHandler) handler() slog.Handler {
+	return *s.h.Load()
+}
+
+func (s *swapHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.handler().Enabled(ctx, level)
+}
+
+func (s *swapHandler) Handle(ctx context.Context, r slog.Record) error {
+	return s.handler().Handle(ctx, r)
+}
+
+func (s *swapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return s.handler().WithAttrs(attrs)
+}
+
+func (s *swapHandler) WithGroup(name string) slog.Handler {
+	return s.handler().WithGroup(name)
+}
+
+var colors = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+// TerminalHandler is an slog.Handler that prints startup messages in their
+// requested color, prefixed by "Deprecated: " or "Warning: " for those severities.
+// Other records are printed as "golinker: message key=value ...".
+type TerminalHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+// NewTerminalHandler returns a TerminalHandler that writes records at or above level to w.
+func NewTerminalHandler(w io.Writer, level slog.Leveler) *TerminalHandler {
+	return &TerminalHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *TerminalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *TerminalHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, a := range attrs {
+		if a.Key == LogKeyColor {
+			c, ok := colors[a.Value.String()]
+			if !ok {
+				c = color.FgBlack
+			}
+			msg := r.Message
+			for _, a := range attrs {
+				if a.Key == LogKeySeverity {
+					switch a.Value.String() {
+					case SeverityDeprecation.String():
+						msg = "Deprecated: " + msg
+					case SeverityWarning.String():
+						msg = "Warning: " + msg
+					}
+				}
+			}
+			_, err := color.New(c).Fprintln(h.w, msg)
+			return err
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(pkgname + ": " + r.Message)
+	for _, a := range attrs {
+		b.WriteString(" " + a.String())
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *TerminalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &h2
+}
+
+func (h *TerminalHandler) WithGroup(name string) slog.Handler {
+	return h // groups are flattened
+}
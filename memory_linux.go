@@ -0,0 +1,50 @@
+package golinker
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// writeBytesToMemory writes the package's object file to an anonymous memfd file and
+// returns its /proc/self/fd path. It reports false if memfd_create or /proc is unavailable.
+func (l *Linker) writeBytesToMemory(pkg []byte, fullPackageName string, max int64) (string, bool, error) {
+	fd, err := unix.MemfdCreate(fullPackageName, unix.MFD_CLOEXEC)
+	if err != nil {
+		return "", false, nil
+	}
+	f := os.NewFile(uintptr(fd), fullPackageName)
+	dst := "/proc/self/fd/" + strconv.Itoa(fd)
+	if _, err := os.Stat(dst); err != nil {
+		f.Close()
+		return "", false, nil
+	}
+
+	r, closer, err := decompress(pkg, max)
+	if err != nil {
+		f.Close()
+		return "", false, &Error{Name: fullPackageName, Err: ErrWriteFailed, Cause: err}
+	}
+	defer closer()
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return "", false, &Error{Name: fullPackageName, Err: ErrWriteFailed, Cause: err}
+	}
+
+	l.mu.Lock()
+	l.memFiles[dst] = f
+	l.mu.Unlock()
+	return dst, true, nil
+}
+
+// removeFile releases a temporary object file. mu must be held.
+func (l *Linker) removeFile(path string) {
+	if f, ok := l.memFiles[path]; ok {
+		f.Close()
+		delete(l.memFiles, path)
+		return
+	}
+	os.Remove(path)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package golinker
+
+import "os"
+
+// writeBytesToMemory is only supported on Linux.
+func (l *Linker) writeBytesToMemory(pkg []byte, fullPackageName string, max int64) (string, bool, error) {
+	return "", false, nil
+}
+
+// removeFile releases a temporary object file. mu must be held.
+func (l *Linker) removeFile(path string) {
+	os.Remove(path)
+}
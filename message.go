@@ -0,0 +1,163 @@
+package golinker
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity of a startup message.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityNotice
+	SeverityDeprecation
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityNotice:
+		return "notice"
+	case SeverityDeprecation:
+		return "deprecation"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "Severity(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Level returns the slog.Level startup messages of this severity are logged at.
+func (s Severity) Level() slog.Level {
+	switch s {
+	case SeverityNotice:
+		return slog.LevelInfo + 1
+	case SeverityDeprecation:
+		return slog.LevelInfo + 2
+	case SeverityWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// Message is a startup message displayed when a module gets initialized.
+type Message struct {
+	Text     string
+	Color    string // eg. "red". Defaults to black.
+	Severity Severity
+
+	// Expires escalates the message to SeverityWarning from this time onwards.
+	// eg. a deprecation notice that becomes a warning once support has ended.
+	Expires time.Time
+}
+
+type startupMessage struct {
+	moduleName string
+	Message
+}
+
+// SuppressEnv is the environment variable listing modules (comma separated) whose
+// startup messages are not displayed. "all" suppresses every module.
+const SuppressEnv = "GOLINKER_SUPPRESS"
+
+// LoadMessage schedules a startup message to be displayed when a module gets initialized.
+// message can be prefixed by a color (eg. "red::message"). It is sent to the log handler
+// (see SetLogHandler).
+func LoadMessage(moduleName, message string) {
+	Default.LoadMessage(moduleName, message)
+}
+
+// LoadMessageWith schedules a startup message with a severity. Messages are displayed
+// in registration order. Registering again for the same module replaces its message.
+func LoadMessageWith(moduleName string, m Message) {
+	Default.LoadMessageWith(moduleName, m)
+}
+
+// SuppressMessages stops the startup messages of the given modules from being displayed.
+// "all" suppresses every module.
+func SuppressMessages(moduleNames ...string) {
+	Default.SuppressMessages(moduleNames...)
+}
+
+// LoadMessage schedules a startup message to be displayed when l first links.
+func (l *Linker) LoadMessage(moduleName, message string) {
+	if message == "" {
+		return
+	}
+	m := Message{Text: message, Color: "black"}
+	if pos := strings.Index(message, "::"); pos != -1 {
+		if _, ok := colors[message[0:pos]]; ok {
+			m.Text = message[pos+2:]
+			m.Color = message[0:pos]
+		}
+	}
+	l.LoadMessageWith(moduleName, m)
+}
+
+// LoadMessageWith schedules a startup message with a severity to be displayed when l links.
+func (l *Linker) LoadMessageWith(moduleName string, m Message) {
+	if m.Text == "" {
+		return
+	}
+	if m.Color == "" {
+		m.Color = "black"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.startupMessages {
+		if l.startupMessages[i].moduleName == moduleName {
+			l.startupMessages[i].Message = m
+			return
+		}
+	}
+	l.startupMessages = append(l.startupMessages, startupMessage{moduleName: moduleName, Message: m})
+}
+
+// SuppressMessages stops l from displaying the startup messages of the given modules.
+func (l *Linker) SuppressMessages(moduleNames ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, n := range moduleNames {
+		l.suppressed[n] = true
+	}
+}
+
+// isSuppressed reports whether the startup message of a module should not be displayed.
+// mu must be held.
+func (l *Linker) isSuppressed(moduleName string) bool {
+	if l.suppressed["all"] || l.suppressed[moduleName] {
+		return true
+	}
+	for _, n := range strings.Split(os.Getenv(SuppressEnv), ",") {
+		if n = strings.TrimSpace(n); n == "all" || n == moduleName {
+			return true
+		}
+	}
+	return false
+}
+
+// printStartupMessages queues the scheduled startup messages for the log handler.
+// mu must be held. They are sent by flushLog once it is released.
+func (l *Linker) printStartupMessages() {
+	now := time.Now()
+	for _, m := range l.startupMessages {
+		if l.isSuppressed(m.moduleName) {
+			continue
+		}
+		severity := m.Severity
+		if !m.Expires.IsZero() && !now.Before(m.Expires) {
+			severity = SeverityWarning
+		}
+		l.queueLog(severity.Level(), m.Text,
+			slog.String(LogKeyModule, m.moduleName),
+			slog.String(LogKeyColor, m.Color),
+			slog.String(LogKeySeverity, severity.String()),
+		)
+	}
+	l.startupMessages = []startupMessage{}
+}
@@ -0,0 +1,269 @@
+package golinker
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/pkujhd/goloader"
+)
+
+// Module is a managed alternative to Load for packages that may be unloaded
+// to reclaim their code and data memory, or replaced at runtime with Reload.
+//
+// Callers Acquire the CodeModule before using any of its functions or variables
+// and Release it when done. Unload refuses to run while references are held.
+//
+// Modules linked in a later generation may resolve symbols against this module.
+// They must be unloaded first.
+type Module struct {
+	linker          *Linker
+	fullPackageName string
+	pattern         string
+	ptrs            []Var
+
+	mu       sync.Mutex
+	cm       *CodeModule         // current version
+	refs     map[*CodeModule]int // references held per version
+	unloaded bool
+}
+
+// ReloadReport describes how the exported functions of a package changed during a Reload.
+type ReloadReport struct {
+	Added   []string // only present in the new object
+	Removed []string // only present in the old object. A non-empty list aborts the reload.
+}
+
+// NewModule returns a Module for a package. The arguments are the same as Load.
+// The package is lazy-loaded by the first Acquire.
+func NewModule(fullPackageName string, pattern string, ptrs ...Var) *Module {
+	return Default.NewModule(fullPackageName, pattern, ptrs...)
+}
+
+// NewModule returns a Module for a package registered with l.
+func (l *Linker) NewModule(fullPackageName string, pattern string, ptrs ...Var) *Module {
+	return &Module{
+		linker:          l,
+		fullPackageName: fullPackageName,
+		pattern:         pattern,
+		ptrs:            ptrs,
+		refs:            map[*CodeModule]int{},
+	}
+}
+
+// Acquire loads the package if required and returns its current CodeModule.
+// Every successful Acquire must be paired with a Release.
+func (m *Module) Acquire() (*CodeModule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unloaded {
+		return nil, &Error{Name: m.fullPackageName, Err: ErrModuleUnloaded}
+	}
+	if m.cm == nil {
+		cm, err := m.linker.load(m.fullPackageName, m.pattern, m.ptrs)
+		if err != nil {
+			return nil, err
+		}
+		m.cm = cm
+	}
+	m.refs[m.cm]++
+	return m.cm, nil
+}
+
+// Release gives back a CodeModule returned by Acquire. Releasing the last
+// reference to a version replaced by Reload unloads it.
+func (m *Module) Release(codeModule *CodeModule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs[codeModule] == 0 {
+		panic(pkgname + ": " + m.fullPackageName + ": Release without matching Acquire")
+	}
+	m.refs[codeModule]--
+	if m.refs[codeModule] == 0 {
+		delete(m.refs, codeModule)
+		if codeModule != m.cm {
+			m.linker.unloadVersion(codeModule)
+		}
+	}
+}
+
+// Refs returns the number of references currently held across all versions.
+func (m *Module) Refs() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.refs {
+		n += r
+	}
+	return n
+}
+
+// Lookup returns the memory-address of a symbol in the current version.
+// Use it instead of a cached SymbolPtr so calls follow a Reload.
+func (m *Module) Lookup(fullSymbolName string) (unsafe.Pointer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unloaded || m.cm == nil {
+		return nil, &Error{Name: m.fullPackageName, Err: ErrModuleUnloaded}
+	}
+	return Lookup(fullSymbolName, m.cm)
+}
+
+// Unload unloads the package and sets every Var to nil.
+// It returns ErrModuleInUse if references are held. Once unloaded,
+// the Module can not be acquired again.
+func (m *Module) Unload() error {
+	defer m.linker.flushLog()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.refs) > 0 {
+		n := 0
+		for _, r := range m.refs {
+			n += r
+		}
+		return &Error{Name: m.fullPackageName, Err: ErrModuleInUse, Cause: fmt.Errorf("%d references held", n)}
+	}
+	m.unloaded = true
+	if m.cm == nil {
+		return nil
+	}
+	for _, p := range m.ptrs {
+		*(*unsafe.Pointer)(p.Ptr) = nil
+	}
+	m.linker.unloadVersion(m.cm)
+	m.cm = nil
+	m.linker.queueLog(slog.LevelDebug, "unload", slog.String("package", m.fullPackageName))
+	return nil
+}
+
+// Reload replaces the package with a newer version of its object file.
+// object accepts the same values as LoadObject.
+//
+// The new object is linked and loaded, every Var is re-pointed to its variables
+// and Acquire and Lookup use the new CodeModule from then on. The previous
+// CodeModule is unloaded once every reference to it has been released.
+//
+// If the new object no longer exports a function that the old one did (including
+// the Var accessors), the reload is abandoned and ErrReloadIncompatible is returned
+// together with the report.
+func (m *Module) Reload(object interface{}) (*ReloadReport, error) {
+	defer m.linker.flushLog()
+	objpath, storage, err := m.linker.objectPath(m.fullPackageName, object)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unloaded {
+		m.linker.mu.Lock()
+		m.linker.removeTemp(objpath)
+		m.linker.mu.Unlock()
+		return nil, &Error{Name: m.fullPackageName, Err: ErrModuleUnloaded}
+	}
+
+	m.linker.symMu.RLock()
+	defer m.linker.symMu.RUnlock()
+
+	gen, syms, err := m.linker.relink(m.fullPackageName, objpath, m.cm)
+	if err != nil {
+		return nil, err
+	}
+	if report := m.linker.unresolved(gen.linker, syms); report != nil {
+		return nil, &Error{Name: m.fullPackageName, Err: ErrLoadFailed, Cause: report}
+	}
+	cm, err := goloader.Load(gen.linker, syms)
+	if err != nil {
+		return nil, &Error{Name: m.fullPackageName, Err: ErrLoadFailed, Cause: err}
+	}
+
+	report := &ReloadReport{}
+	if m.cm != nil {
+		report = diffExports(m.fullPackageName, m.cm, cm)
+	}
+	for _, p := range m.ptrs {
+		name := m.fullPackageName + "." + fmt.Sprintf(m.pattern, p.Name)
+		if cm.Syms[name] == 0 && !contains(report.Removed, name) {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+	if len(report.Removed) > 0 {
+		cm.Unload()
+		return report, &Error{Name: m.fullPackageName, Err: ErrReloadIncompatible, Cause: fmt.Errorf("removed: %s", strings.Join(report.Removed, ", "))}
+	}
+
+	// Nothing is published until every Var resolves in the new module
+	if err := pointVars(m.fullPackageName, m.pattern, m.ptrs, cm); err != nil {
+		cm.Unload()
+		return report, err
+	}
+	m.linker.addGeneration(gen, storage)
+	m.linker.addLoaded(cm, gen.linker)
+
+	old := m.cm
+	m.cm = cm
+	m.linker.queueLog(slog.LevelDebug, "reload", slog.String("package", m.fullPackageName), slog.Any("added", report.Added))
+	if old != nil && m.refs[old] == 0 {
+		m.linker.unloadVersion(old)
+	}
+	return report, nil
+}
+
+// unloadVersion unloads a single version of a module.
+func (l *Linker) unloadVersion(codeModule *CodeModule) {
+	l.removeLoaded(codeModule)
+	codeModule.Unload()
+}
+
+// diffExports compares the exported functions of fullPackageName in two modules.
+func diffExports(fullPackageName string, old, new *CodeModule) *ReloadReport {
+	report := &ReloadReport{}
+	for name := range old.Syms {
+		if isExported(fullPackageName, name) && new.Syms[name] == 0 {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+	for name := range new.Syms {
+		if isExported(fullPackageName, name) && old.Syms[name] == 0 {
+			report.Added = append(report.Added, name)
+		}
+	}
+	sort.Strings(report.Removed)
+	sort.Strings(report.Added)
+	return report
+}
+
+// isExported reports whether symbol is an exported function or method of fullPackageName.
+// Closures and generic instantiations are ignored since their names are not stable.
+func isExported(fullPackageName string, symbol string) bool {
+	name := strings.TrimPrefix(symbol, fullPackageName+".")
+	if name == symbol || strings.ContainsAny(name, "[") {
+		return false
+	}
+	parts := strings.Split(name, ".") // Func, T.Method or (*T).Method
+	if len(parts) > 2 {
+		return false
+	}
+	for _, part := range parts {
+		part = strings.TrimSuffix(strings.TrimPrefix(part, "(*"), ")")
+		r, _ := utf8.DecodeRuneInString(part)
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
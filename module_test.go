@@ -0,0 +1,61 @@
+package golinker_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/romance-dev/golinker"
+	"github.com/romance-dev/golinker/golinkertest"
+)
+
+// TestModuleConcurrent loads, calls and reloads a real package while other goroutines
+// register messages and types and link.
+func TestModuleConcurrent(t *testing.T) {
+	obj := golinkertest.Compile(t, "golinkertest/testdata/vendorpkg")
+	l := golinkertest.NewLinker(t)
+	if err := l.LoadObjectE(obj.Package, obj.Path); err != nil {
+		t.Fatal(err)
+	}
+	m := l.NewModule(obj.Package, "%s")
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				l.LoadMessage(fmt.Sprintf("example.com/mod%d", i), fmt.Sprintf("call %d", j))
+				l.RegTypes(i, j)
+				if err := l.Link(); err != nil {
+					t.Error(err)
+					return
+				}
+
+				codeModule, err := m.Acquire()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				add, err := golinker.Func[func(int, int) int](l, codeModule, obj.Package+".Add")
+				if err != nil {
+					t.Error(err)
+				} else if got := add(i, j); got != i+j {
+					t.Errorf("Add(%d, %d) = %d", i, j, got)
+				}
+				m.Release(codeModule)
+
+				if i == 0 && j%5 == 0 {
+					if _, err := m.Reload(obj.Path); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := m.Unload(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,237 @@
+package golinker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ObjectSource can be implemented to supply object files from anywhere.
+// It can be passed to LoadObject and LoadArchive.
+type ObjectSource interface {
+	// Open returns the contents of the object file (optionally compressed).
+	Open() (io.ReadCloser, error)
+}
+
+// FSObject is an ObjectSource for a file within a file system such as an embed.FS.
+type FSObject struct {
+	FS   fs.FS
+	Path string
+}
+
+func (o FSObject) Open() (io.ReadCloser, error) {
+	return o.FS.Open(o.Path)
+}
+
+// readSource reads an io.Reader or ObjectSource.
+func readSource(fullPackageName string, object interface{}) ([]byte, error) {
+	var r io.Reader
+	switch src := object.(type) {
+	case ObjectSource:
+		rc, err := src.Open()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, &Error{Name: fullPackageName, Err: ErrObjectNotFound, Cause: err}
+			}
+			return nil, &Error{Name: fullPackageName, Err: ErrReadFailed, Cause: err}
+		}
+		defer rc.Close()
+		r = rc
+	case io.Reader:
+		r = src
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &Error{Name: fullPackageName, Err: ErrReadFailed, Cause: err}
+	}
+	return b, nil
+}
+
+// LoadArchive loads every object file within a zip or (optionally compressed) tar archive.
+// The package name of each object is its path within the archive with the extensions
+// .gz, .zst, .xz, .o, .a and .golinker removed. eg. github.com/vendor/pkg.o.gz => github.com/vendor/pkg
+//
+// archive can be a path, []byte, io.Reader, ObjectSource or SignedObject.
+func LoadArchive(archive interface{}) {
+	Default.LoadArchive(archive)
+}
+
+// LoadArchiveE is like LoadArchive but returns an error instead of panicking.
+func LoadArchiveE(archive interface{}) error {
+	return Default.LoadArchiveE(archive)
+}
+
+// LoadArchive loads every object file within an archive into l. See the package-level LoadArchive.
+func (l *Linker) LoadArchive(archive interface{}) {
+	if err := l.LoadArchiveE(archive); err != nil {
+		panic(err)
+	}
+}
+
+// LoadArchiveE is like LoadArchive but returns an error instead of panicking.
+func (l *Linker) LoadArchiveE(archive interface{}) error {
+	var b []byte
+	switch a := archive.(type) {
+	case SignedObject:
+		if err := l.verify("archive", a); err != nil {
+			return err
+		}
+		b = a.Data
+	default:
+		if l.signaturesRequired() {
+			return &Error{Name: "archive", Err: ErrUnsigned}
+		}
+		switch a := archive.(type) {
+		case string:
+			var err error
+			b, err = os.ReadFile(a)
+			if errors.Is(err, os.ErrNotExist) {
+				return &Error{Name: a, Err: ErrObjectNotFound, Cause: err}
+			} else if err != nil {
+				return &Error{Name: a, Err: ErrReadFailed, Cause: err}
+			}
+		case []byte:
+			b = a
+		case ObjectSource, io.Reader:
+			var err error
+			if b, err = readSource("archive", a); err != nil {
+				return err
+			}
+		default:
+			return &Error{Name: "archive", Err: ErrUnsupportedObject, Cause: fmt.Errorf("%T", archive)}
+		}
+	}
+
+	entries, err := archiveEntries(b, l.maxObjectSize.Load())
+	if err != nil {
+		return &Error{Name: "archive", Err: ErrUnsupportedObject, Cause: err}
+	}
+	objs := []toLoadObj{}
+	storages := []Storage{}
+	for _, e := range entries {
+		objpath, storage, err := l.writeObject(e.data, e.pkgName)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, toLoadObj{
+			objpath: objpath,
+			pkgName: e.pkgName,
+			reg:     register(e.pkgName),
+		})
+		storages = append(storages, storage)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, o := range objs {
+		l.objectStorage[o.pkgName] = storages[i]
+		l.toLoad = append(l.toLoad, o)
+	}
+	return nil
+}
+
+type archiveEntry struct {
+	pkgName string
+	data    []byte
+}
+
+// archiveEntries returns the object files within a zip or tar archive.
+// max limits the total size of the decompressed entries (see decompress).
+// An archive without object files is an error.
+func archiveEntries(b []byte, max int64) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	var err error
+	if bytes.HasPrefix(b, []byte("PK\x03\x04")) {
+		entries, err = zipEntries(b, max)
+	} else {
+		entries, err = tarEntries(b, max)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no object files found in archive")
+	}
+	return entries, nil
+}
+
+// zipEntries returns the files within a zip archive.
+func zipEntries(b []byte, max int64) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	limit := &sizeLimitReader{n: max} // shared by every entry like the stream of a tar archive
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = rc
+		if max > 0 {
+			limit.r = rc
+			r = limit
+		}
+		data, err := io.ReadAll(r)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{pkgName: archivePkgName(f.Name), data: data})
+	}
+	return entries, nil
+}
+
+// tarEntries returns the regular files within an (optionally compressed) tar archive.
+func tarEntries(b []byte, max int64) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+	r, closer, err := decompress(b, max)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{pkgName: archivePkgName(hdr.Name), data: data})
+	}
+	return entries, nil
+}
+
+// archivePkgName derives the package name from the path of an archive entry.
+func archivePkgName(name string) string {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	for _, ext := range []string{".gz", ".zst", ".xz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	for _, ext := range []string{".o", ".a", ".golinker"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
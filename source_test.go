@@ -0,0 +1,39 @@
+package golinker_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"testing/iotest"
+
+	"github.com/romance-dev/golinker"
+)
+
+func TestLoadArchiveEmpty(t *testing.T) {
+	var zb, tb bytes.Buffer
+	zip.NewWriter(&zb).Close()
+	tar.NewWriter(&tb).Close()
+	for name, b := range map[string][]byte{"zip": zb.Bytes(), "tar": tb.Bytes()} {
+		l, err := golinker.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.LoadArchiveE(b); !errors.Is(err, golinker.ErrUnsupportedObject) {
+			t.Errorf("%s: got %v, want ErrUnsupportedObject", name, err)
+		}
+		l.Close()
+	}
+}
+
+func TestLoadArchiveReadFailed(t *testing.T) {
+	l, err := golinker.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.LoadArchiveE(iotest.ErrReader(errors.New("boom"))); !errors.Is(err, golinker.ErrReadFailed) {
+		t.Errorf("got %v, want ErrReadFailed", err)
+	}
+}
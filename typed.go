@@ -0,0 +1,197 @@
+package golinker
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/pkujhd/goloader/obj"
+)
+
+const ptrSize = unsafe.Sizeof(uintptr(0))
+
+// Func returns the function fullSymbolName as a value of type T, which must be a func type.
+// Methods take their receiver as the first argument.
+//
+// The signature is checked against the object file that l loaded codeModule from before
+// the value is returned: the function's type symbol must match T if the object records it,
+// and the size of its arguments and results must match T.
+//
+//	add, err := golinker.Func[func(int, int) int](golinker.Default, codeModule, "github.com/vendor/pkg.Add")
+func Func[T any](l *Linker, codeModule *CodeModule, fullSymbolName string) (T, error) {
+	var zero T
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Func {
+		return zero, &Error{Name: fullSymbolName, Err: ErrTypeMismatch, Cause: fmt.Errorf("%s is not a func type", typ)}
+	}
+	ptr, err := Lookup(fullSymbolName, codeModule)
+	if err != nil {
+		return zero, err
+	}
+	sym := l.objSymbol(codeModule, fullSymbolName)
+	if sym == nil || sym.Func == nil {
+		return zero, &Error{Name: fullSymbolName, Err: ErrTypeMismatch, Cause: fmt.Errorf("no type information")}
+	}
+	if name := typeSymbolName(typ); sym.Type != "" && name != "" && sym.Type != name {
+		return zero, &Error{Name: fullSymbolName, Err: ErrTypeMismatch, Cause: fmt.Errorf("object has %s, requested %s", sym.Type, name)}
+	}
+	if args := argsSize(typ); uintptr(sym.Func.Args) != args {
+		return zero, &Error{Name: fullSymbolName, Err: ErrTypeMismatch, Cause: fmt.Errorf("object has %d bytes of arguments, %s has %d", sym.Func.Args, typ, args)}
+	}
+	return *(*T)(ptr), nil
+}
+
+// Variable returns a pointer to a package-level variable of type T.
+// accessor is the full name of the variable's accessor function (of type
+// func() unsafe.Pointer) as used in the pattern passed to Load.
+//
+// The variable referenced by the accessor is checked against T using its type symbol
+// (if the object that l loaded codeModule from records it) and its size.
+//
+//	counter, err := golinker.Variable[int](golinker.Default, codeModule, "github.com/vendor/pkg.Counter_ptr")
+func Variable[T any](l *Linker, codeModule *CodeModule, accessor string) (*T, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	ptr, err := Lookup(accessor, codeModule)
+	if err != nil {
+		return nil, err
+	}
+	sym := l.objSymbol(codeModule, accessor)
+	if sym == nil {
+		return nil, &Error{Name: accessor, Err: ErrTypeMismatch, Cause: fmt.Errorf("no type information")}
+	}
+	v := l.accessedVariable(codeModule, accessor, sym)
+	if v == nil {
+		return nil, &Error{Name: accessor, Err: ErrTypeMismatch, Cause: fmt.Errorf("could not determine the variable it accesses")}
+	}
+	if name := typeSymbolName(typ); v.Type != "" && name != "" && v.Type != name {
+		return nil, &Error{Name: v.Name, Err: ErrTypeMismatch, Cause: fmt.Errorf("object has %s, requested %s", v.Type, name)}
+	}
+	if uintptr(v.Size) != typ.Size() {
+		return nil, &Error{Name: v.Name, Err: ErrTypeMismatch, Cause: fmt.Errorf("object has %d bytes, %s has %d", v.Size, typ, typ.Size())}
+	}
+	return (*T)((*(*func() unsafe.Pointer)(ptr))()), nil
+}
+
+// accessedVariable returns the single package-level variable referenced by an accessor function.
+func (l *Linker) accessedVariable(codeModule *CodeModule, accessor string, sym *obj.ObjSymbol) *obj.ObjSymbol {
+	pkgPrefix := accessor[:strings.LastIndex(accessor, ".")+1]
+	var found *obj.ObjSymbol
+	for _, r := range sym.Reloc {
+		if !strings.HasPrefix(r.SymName, pkgPrefix) || strings.ContainsAny(r.SymName[len(pkgPrefix):], ".:") {
+			continue
+		}
+		target := l.objSymbol(codeModule, r.SymName)
+		if target == nil || target.Func != nil {
+			continue
+		}
+		if found != nil && found.Name != target.Name {
+			return nil // ambiguous
+		}
+		found = target
+	}
+	return found
+}
+
+// argsSize returns the size of the arguments and results of a function
+// as laid out on the stack (ABI0). This is what the object file records.
+func argsSize(typ reflect.Type) uintptr {
+	var off uintptr
+	add := func(t reflect.Type) {
+		off = alignUp(off, uintptr(t.Align()))
+		off += t.Size()
+	}
+	for i := 0; i < typ.NumIn(); i++ {
+		add(typ.In(i))
+	}
+	off = alignUp(off, ptrSize)
+	for i := 0; i < typ.NumOut(); i++ {
+		add(typ.Out(i))
+	}
+	return alignUp(off, ptrSize)
+}
+
+func alignUp(n, a uintptr) uintptr {
+	return (n + a - 1) &^ (a - 1)
+}
+
+// typeSymbolName returns the linker's name for the type symbol of typ,
+// or "" for types whose names it does not reproduce (structs and non-empty interfaces).
+func typeSymbolName(typ reflect.Type) string {
+	name := linkString(typ)
+	if name == "" {
+		return ""
+	}
+	return "type:" + name
+}
+
+func linkString(typ reflect.Type) string {
+	if typ.Name() != "" {
+		if typ.PkgPath() == "" {
+			return typ.Name() // predeclared
+		}
+		return typ.PkgPath() + "." + typ.Name()
+	}
+
+	elem := func() string { return linkString(typ.Elem()) }
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if e := elem(); e != "" {
+			return "*" + e
+		}
+	case reflect.Slice:
+		if e := elem(); e != "" {
+			return "[]" + e
+		}
+	case reflect.Array:
+		if e := elem(); e != "" {
+			return "[" + strconv.Itoa(typ.Len()) + "]" + e
+		}
+	case reflect.Chan:
+		if e := elem(); e != "" {
+			switch typ.ChanDir() {
+			case reflect.RecvDir:
+				return "<-chan " + e
+			case reflect.SendDir:
+				return "chan<- " + e
+			}
+			return "chan " + e
+		}
+	case reflect.Map:
+		k, v := linkString(typ.Key()), elem()
+		if k != "" && v != "" {
+			return "map[" + k + "]" + v
+		}
+	case reflect.Interface:
+		if typ.NumMethod() == 0 {
+			return "interface {}"
+		}
+	case reflect.Func:
+		in := make([]string, typ.NumIn())
+		for i := range in {
+			if in[i] = linkString(typ.In(i)); in[i] == "" {
+				return ""
+			}
+		}
+		if typ.IsVariadic() {
+			in[len(in)-1] = "..." + strings.TrimPrefix(in[len(in)-1], "[]")
+		}
+		out := make([]string, typ.NumOut())
+		for i := range out {
+			if out[i] = linkString(typ.Out(i)); out[i] == "" {
+				return ""
+			}
+		}
+		s := "func(" + strings.Join(in, ", ") + ")"
+		switch len(out) {
+		case 0:
+		case 1:
+			s += " " + out[0]
+		default:
+			s += " (" + strings.Join(out, ", ") + ")"
+		}
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package golinker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkujhd/goloader"
+)
+
+// Fix suggests how an unresolved symbol can be made available to the linker.
+type Fix int
+
+const (
+	// FixRegTypes: the symbol is a type or method. Register the type from the host with RegTypes.
+	FixRegTypes Fix = iota
+	// FixRegSymbolWithPath: the host links the package but not the symbol (it was stripped
+	// or eliminated as dead code). Register symbols from an unstripped binary with RegSymbolWithPath.
+	FixRegSymbolWithPath
+	// FixImport: the host does not link the package at all. Import it (eg. import _ "pkg").
+	FixImport
+)
+
+func (f Fix) String() string {
+	switch f {
+	case FixRegTypes:
+		return "RegTypes"
+	case FixRegSymbolWithPath:
+		return "RegSymbolWithPath"
+	case FixImport:
+		return "import"
+	}
+	return "Fix(" + strconv.Itoa(int(f)) + ")"
+}
+
+// UnresolvedSymbol is an external symbol that an object references but neither
+// the host nor a loaded module provides.
+type UnresolvedSymbol struct {
+	Name    string
+	Package string
+	Fix     Fix
+}
+
+// UnresolvedReport lists every unresolved symbol of a link. It is returned as
+// the Cause of an ErrLoadFailed error and can be extracted with errors.As.
+type UnresolvedReport struct {
+	Symbols []UnresolvedSymbol // sorted by package and name
+}
+
+// ByPackage groups the symbols by package.
+func (r *UnresolvedReport) ByPackage() map[string][]UnresolvedSymbol {
+	m := map[string][]UnresolvedSymbol{}
+	for _, s := range r.Symbols {
+		m[s.Package] = append(m[s.Package], s)
+	}
+	return m
+}
+
+func (r *UnresolvedReport) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d unresolved symbols", len(r.Symbols))
+	pkg := ""
+	for i, s := range r.Symbols {
+		if i == 0 || s.Package != pkg {
+			pkg = s.Package
+			fmt.Fprintf(&b, "\n  %s:", pkg)
+		}
+		fmt.Fprintf(&b, "\n    %s (fix: %s)", s.Name, s.Fix)
+	}
+	return b.String()
+}
+
+// Unresolved links any pending object files and reports the unresolved symbols
+// of every generation. It returns nil if everything can be resolved.
+func Unresolved() (*UnresolvedReport, error) {
+	return Default.Unresolved()
+}
+
+// Unresolved links any object files pending in l and reports the unresolved symbols.
+func (l *Linker) Unresolved() (*UnresolvedReport, error) {
+	if err := l.Link(); err != nil {
+		return nil, err
+	}
+
+	l.symMu.RLock()
+	defer l.symMu.RUnlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	syms := l.symbols(nil)
+	report := &UnresolvedReport{}
+	seen := map[string]bool{}
+	for _, gen := range l.generations {
+		if gen.err != nil {
+			continue
+		}
+		if r := l.unresolved(gen.linker, syms); r != nil {
+			for _, s := range r.Symbols {
+				if !seen[s.Name] {
+					seen[s.Name] = true
+					report.Symbols = append(report.Symbols, s)
+				}
+			}
+		}
+	}
+	if len(report.Symbols) == 0 {
+		return nil, nil
+	}
+	sortUnresolved(report.Symbols)
+	return report, nil
+}
+
+// unresolved returns the unresolved symbols of a linker, or nil if there are none.
+// symMu must be held.
+func (l *Linker) unresolved(gl *goloader.Linker, syms map[string]uintptr) *UnresolvedReport {
+	names := goloader.UnresolvedSymbols(gl, syms)
+	if len(names) == 0 {
+		return nil
+	}
+
+	hostPkgs := map[string]bool{}
+	for name := range l.symPtr {
+		hostPkgs[symbolPackage(name)] = true
+	}
+
+	report := &UnresolvedReport{}
+	for _, name := range names {
+		s := UnresolvedSymbol{Name: name, Package: symbolPackage(name)}
+		switch {
+		case strings.HasPrefix(name, "type:") || isMethod(s.Package, name):
+			s.Fix = FixRegTypes
+		case hostPkgs[s.Package]:
+			s.Fix = FixRegSymbolWithPath
+		default:
+			s.Fix = FixImport
+		}
+		report.Symbols = append(report.Symbols, s)
+	}
+	sortUnresolved(report.Symbols)
+	return report
+}
+
+func sortUnresolved(symbols []UnresolvedSymbol) {
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Package != symbols[j].Package {
+			return symbols[i].Package < symbols[j].Package
+		}
+		return symbols[i].Name < symbols[j].Name
+	})
+}
+
+// symbolPackage returns the import path of the package a symbol belongs to.
+// eg. type:*github.com/vendor/pkg.T => github.com/vendor/pkg
+func symbolPackage(name string) string {
+	name = strings.TrimPrefix(name, "type:")
+	name = strings.TrimLeft(name, "*[]0123456789")
+	head := name
+	if i := strings.IndexAny(head, "[("); i != -1 {
+		head = head[:i] // ignore type arguments and receivers
+	}
+	slash := strings.LastIndex(head, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot != -1 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// isMethod reports whether name is a method of a type in pkg. eg. pkg.T.M or pkg.(*T).M
+func isMethod(pkg string, name string) bool {
+	rest := strings.TrimPrefix(name, pkg+".")
+	if rest == name || strings.HasPrefix(rest, "init.") || strings.Contains(rest, "func") {
+		return false
+	}
+	return strings.HasPrefix(rest, "(*") || strings.Count(rest, ".") == 1
+}
@@ -0,0 +1,190 @@
+package golinker
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Variant identifies the build an object file was compiled for.
+// Empty fields match any value.
+//
+// The keys of the map forms accepted by LoadObject (eg. map[string][]byte) are
+// parsed with ParseVariant, so a single bundle can serve several platforms:
+//
+//	"1.23.5"                   // any platform (the original form)
+//	"1.23.5/linux/amd64"       // GOOS and GOARCH
+//	"1.23.5/linux/amd64/v3"    // microarchitecture level (GOAMD64, GOARM64, GOARM, ...)
+//	"1.23.5/linux/amd64/race"  // built with -race
+type Variant struct {
+	GoVersion string // without the "go" prefix. eg. 1.23.5
+	GOOS      string
+	GOARCH    string
+	Level     string // value of GOAMD64, GOARM64, GOARM etc. eg. v3
+	Race      bool
+}
+
+func (v Variant) String() string {
+	parts := []string{v.GoVersion}
+	if v.GOOS != "" || v.GOARCH != "" {
+		parts = append(parts, v.GOOS, v.GOARCH)
+	}
+	if v.Level != "" {
+		parts = append(parts, v.Level)
+	}
+	if v.Race {
+		parts = append(parts, "race")
+	}
+	return strings.Join(parts, "/")
+}
+
+// ParseVariant parses a key of the form goversion[/goos/goarch][/level][/race].
+func ParseVariant(key string) (Variant, error) {
+	parts := strings.Split(key, "/")
+	v := Variant{GoVersion: strings.TrimPrefix(parts[0], "go")}
+	if v.GoVersion == "" {
+		return Variant{}, fmt.Errorf("%s: invalid variant %q: missing go version", pkgname, key)
+	}
+	rest := parts[1:]
+	if len(rest) > 0 && rest[len(rest)-1] == "race" {
+		v.Race = true
+		rest = rest[:len(rest)-1]
+	}
+	switch len(rest) {
+	case 0:
+	case 2:
+		v.GOOS, v.GOARCH = rest[0], rest[1]
+	case 3:
+		v.GOOS, v.GOARCH, v.Level = rest[0], rest[1], rest[2]
+	default:
+		return Variant{}, fmt.Errorf("%s: invalid variant %q", pkgname, key)
+	}
+	return v, nil
+}
+
+var onceHostVariant sync.Once
+var hostVariant Variant
+
+// HostVariant returns the Variant of the running executable. The microarchitecture
+// level and race setting are read from debug.ReadBuildInfo.
+func HostVariant() Variant {
+	onceHostVariant.Do(func() {
+		hostVariant = Variant{
+			GoVersion: strings.TrimPrefix(runtime.Version(), "go"),
+			GOOS:      runtime.GOOS,
+			GOARCH:    runtime.GOARCH,
+		}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		levelKey := "GO" + strings.ToUpper(runtime.GOARCH) // eg. GOAMD64, GOARM64
+		if runtime.GOARCH == "arm" {
+			levelKey = "GOARM"
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case levelKey:
+				hostVariant.Level = s.Value
+			case "-race":
+				hostVariant.Race = s.Value == "true"
+			}
+		}
+	})
+	return hostVariant
+}
+
+// score reports whether an object built for v can be linked into host and how
+// specific the match is. Higher is better.
+func (v Variant) score(host Variant) (int, bool) {
+	if v.GoVersion != host.GoVersion {
+		return 0, false
+	}
+	score := 0
+	if v.GOOS != "" {
+		if v.GOOS != host.GOOS {
+			return 0, false
+		}
+		score += 1000
+	}
+	if v.GOARCH != "" {
+		if v.GOARCH != host.GOARCH {
+			return 0, false
+		}
+		score += 1000
+	}
+	if v.Race {
+		if !host.Race {
+			return 0, false
+		}
+		score += 1000
+	}
+	if v.Level != "" {
+		// Code for a lower level runs on a higher level. Prefer the highest usable level.
+		lv, ok1 := parseLevel(v.Level)
+		hv, ok2 := parseLevel(host.Level)
+		switch {
+		case ok1 && ok2:
+			if lv > hv {
+				return 0, false
+			}
+			score += 100 + lv
+		case v.Level == host.Level:
+			score += 100
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// parseLevel converts a level such as v3, v8.2 or 7 to a comparable number.
+func parseLevel(level string) (int, bool) {
+	level = strings.TrimPrefix(strings.SplitN(level, ",", 2)[0], "v") // GOARM=7,softfloat
+	major, minor, _ := strings.Cut(level, ".")
+	ma, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, false
+	}
+	mi := 0
+	if minor != "" {
+		if mi, err = strconv.Atoi(minor); err != nil {
+			return 0, false
+		}
+	}
+	return ma*10 + mi, true
+}
+
+// selectVariant returns the most specific entry of m that matches the running executable.
+func selectVariant[T any](fullPackageName string, m map[string]T) (T, error) {
+	host := HostVariant()
+	var (
+		best      T
+		bestKey   string
+		bestScore = -1
+		keys      []string
+	)
+	for key, val := range m {
+		keys = append(keys, key)
+		v, err := ParseVariant(key)
+		if err != nil {
+			continue
+		}
+		score, ok := v.score(host)
+		if !ok {
+			continue
+		}
+		if score > bestScore || score == bestScore && key < bestKey {
+			best, bestKey, bestScore = val, key, score
+		}
+	}
+	if bestScore == -1 {
+		sort.Strings(keys)
+		return best, &Error{Name: fullPackageName, Err: ErrUnsupportedGoVersion, Cause: fmt.Errorf("no variant for %s (available: %s)", host, strings.Join(keys, ", "))}
+	}
+	return best, nil
+}